@@ -0,0 +1,454 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/henrylee2cn/faygo"
+	"gopkg.in/yaml.v2"
+)
+
+// configFiles are the names of the project configuration file, in order of precedence.
+var configFiles = []string{"fay.yaml", "fay.yml", "fay.toml"}
+
+type (
+	// fayConfig is the per-project configuration of fay.
+	fayConfig struct {
+		Watch   watchConfig       `yaml:"watch" toml:"watch"`
+		Build   buildConfig       `yaml:"build" toml:"build"`
+		Run     runConfig         `yaml:"run" toml:"run"`
+		Proxy   proxyConfig       `yaml:"proxy" toml:"proxy"`
+		Release releaseConfig     `yaml:"release" toml:"release"` // settings of `fay build`
+		Pack    packConfig        `yaml:"pack" toml:"pack"`       // settings of `fay pack`
+		Env     map[string]string `yaml:"env" toml:"env"`         // environment of the hooks, the build and the app
+		Hooks   hooksConfig       `yaml:"hooks" toml:"hooks"`     // shell commands around the build and the start
+		// Procfile lists the processes supervised next to the app, `Procfile` if it exists
+		Procfile  string          `yaml:"procfile" toml:"procfile"`
+		Processes []processConfig `yaml:"processes" toml:"processes"` // processes supervised next to the app, they complete the Procfile ones
+		file      string
+		dir       string
+	}
+	watchConfig struct {
+		Exts    []string    `yaml:"exts" toml:"exts"`       // extensions of the watched files
+		Include []string    `yaml:"include" toml:"include"` // globs of extra watched files
+		Exclude []string    `yaml:"exclude" toml:"exclude"` // globs of ignored files and directories
+		Delay   string      `yaml:"delay" toml:"delay"`     // debounce delay before building, e.g. `1s`
+		Rules   []watchRule `yaml:"rules" toml:"rules"`     // actions of the changed files, the first matching rule wins
+		delay   time.Duration
+	}
+	watchRule struct {
+		Glob   string `yaml:"glob" toml:"glob"`     // glob of the files, they are watched unless ignored by .gitignore
+		Action string `yaml:"action" toml:"action"` // `rebuild`, `restart` or `reload`
+		action int
+	}
+	buildConfig struct {
+		Cmd    string   `yaml:"cmd" toml:"cmd"`       // build command, it must accept `-o output`
+		Flags  []string `yaml:"flags" toml:"flags"`   // extra build flags
+		Output string   `yaml:"output" toml:"output"` // path of the binary
+	}
+	runConfig struct {
+		Cmd         string      `yaml:"cmd" toml:"cmd"`                   // run command, the binary by default
+		Args        []string    `yaml:"args" toml:"args"`                 // arguments of the app
+		StopSignal  string      `yaml:"stop_signal" toml:"stop_signal"`   // signal asking the app to exit, `SIGTERM` by default
+		StopTimeout string      `yaml:"stop_timeout" toml:"stop_timeout"` // grace period before killing the app, `5s` by default
+		Ready       readyConfig `yaml:"ready" toml:"ready"`               // checks deciding when the app is up
+		// Restart is the policy when the app exits by itself: `never` by default, `on-failure` or `always`
+		Restart      string `yaml:"restart" toml:"restart"`
+		RestartDelay string `yaml:"restart_delay" toml:"restart_delay"` // delay before the first restart, doubled after each crash up to 30s, `1s` by default
+		MaxRestarts  int    `yaml:"max_restarts" toml:"max_restarts"`   // crashes in a row before giving up, `5` by default
+		TailLines    int    `yaml:"tail_lines" toml:"tail_lines"`       // last output lines shown when giving up, `20` by default
+		stopSignal   os.Signal
+		stopTimeout  time.Duration
+		restartDelay time.Duration
+	}
+	readyConfig struct {
+		TCP     string `yaml:"tcp" toml:"tcp"`         // address accepting connections once the app is up
+		HTTP    string `yaml:"http" toml:"http"`       // URL answering below 400 once the app is up
+		Log     string `yaml:"log" toml:"log"`         // regexp of the output line printed once the app is up
+		Timeout string `yaml:"timeout" toml:"timeout"` // max time to get ready, `30s` by default
+		log     *regexp.Regexp
+		timeout time.Duration
+	}
+	proxyConfig struct {
+		Addr        string `yaml:"addr" toml:"addr"`                 // address of the live-reload proxy, disabled if empty
+		Target      string `yaml:"target" toml:"target"`             // URL of the app, `http://127.0.0.1:8080` by default
+		HoldTimeout string `yaml:"hold_timeout" toml:"hold_timeout"` // max time to hold the requests while the app restarts, `30s` by default, `0` disables holding
+		holdTimeout time.Duration
+	}
+	releaseConfig struct {
+		Targets    []string `yaml:"targets" toml:"targets"`         // GOOS/GOARCH targets, the host by default
+		Output     string   `yaml:"output" toml:"output"`           // directory of the artifacts, `dist` by default
+		Version    string   `yaml:"version" toml:"version"`         // `git describe --tags --always --dirty` by default
+		VersionVar string   `yaml:"version_var" toml:"version_var"` // variable set to the version, `main.version` by default
+		CommitVar  string   `yaml:"commit_var" toml:"commit_var"`   // variable set to the commit, `main.commit` by default
+		TimeVar    string   `yaml:"time_var" toml:"time_var"`       // variable set to the build time, `main.buildTime` by default
+		Ldflags    []string `yaml:"ldflags" toml:"ldflags"`         // extra linker flags, e.g. `-s -w`
+	}
+	packConfig struct {
+		Target  string   `yaml:"target" toml:"target"`   // GOOS/GOARCH target, the host by default
+		Format  string   `yaml:"format" toml:"format"`   // `tar.gz` by default, or `zip`
+		Include []string `yaml:"include" toml:"include"` // globs of the packed files and directories, `static`, `view` and `config` by default
+		Exclude []string `yaml:"exclude" toml:"exclude"` // globs of the skipped files and directories
+	}
+	processConfig struct {
+		Name    string   `yaml:"name" toml:"name"`       // prefix of the output lines
+		Cmd     string   `yaml:"cmd" toml:"cmd"`         // shell command line of the process
+		Build   string   `yaml:"build" toml:"build"`     // shell command line of the build, run in dir before the start and on the changes of the watched files
+		Dir     string   `yaml:"dir" toml:"dir"`         // working directory of the build and the process, relative to the project
+		Watch   []string `yaml:"watch" toml:"watch"`     // globs of the files rebuilding the process, or restarting it without a build command
+		Restart string   `yaml:"restart" toml:"restart"` // policy when it exits by itself, like run.restart
+	}
+	hooksConfig struct {
+		PreBuild  []string `yaml:"pre_build" toml:"pre_build"`   // before building, a failure cancels the build
+		PostBuild []string `yaml:"post_build" toml:"post_build"` // after a successful build, a failure cancels the restart
+		PreRun    []string `yaml:"pre_run" toml:"pre_run"`       // before starting the app, a failure cancels the start
+		PostRun   []string `yaml:"post_run" toml:"post_run"`     // after the app is ready
+	}
+)
+
+// cfg is the configuration of the current project.
+var cfg = &fayConfig{}
+
+// loadConfig reads the configuration file.
+// If filename is empty, the first of configFiles in dir is used, and no file is fine.
+func loadConfig(dir, filename string) (*fayConfig, error) {
+	c := &fayConfig{dir: dir}
+	if filename == "" {
+		for _, name := range configFiles {
+			if f := filepath.Join(dir, name); isFile(f) {
+				filename = f
+				break
+			}
+		}
+		if filename == "" {
+			return c, nil
+		}
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".toml":
+		_, err = toml.Decode(string(data), c)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	default:
+		err = errors.New("unsupported config format, use .yaml or .toml")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	c.file = filename
+	return c, nil
+}
+
+// init fills the defaults and checks the values.
+func (c *fayConfig) init(appname string) error {
+	if len(c.Watch.Exts) == 0 {
+		c.Watch.Exts = []string{".go"}
+	}
+	for i, ext := range c.Watch.Exts {
+		if !strings.HasPrefix(ext, ".") {
+			c.Watch.Exts[i] = "." + ext
+		}
+	}
+	c.Watch.delay = time.Second
+	if c.Watch.Delay != "" {
+		d, err := time.ParseDuration(c.Watch.Delay)
+		if err != nil {
+			return fmt.Errorf("watch.delay: %v", err)
+		}
+		c.Watch.delay = d
+	}
+	if c.Watch.Rules == nil {
+		c.Watch.Rules = defaultWatchRules()
+	}
+	for i := range c.Watch.Rules {
+		rule := &c.Watch.Rules[i]
+		action, ok := watchActions[rule.Action]
+		if !ok || rule.Glob == "" {
+			return fmt.Errorf("watch.rules: invalid rule %q: %q, the actions are rebuild, restart and reload", rule.Glob, rule.Action)
+		}
+		rule.action = action
+	}
+	if c.Build.Cmd == "" {
+		c.Build.Cmd = "go build"
+	}
+	if c.Build.Output == "" {
+		c.Build.Output = appname
+		if runtime.GOOS == "windows" {
+			c.Build.Output += ".exe"
+		}
+	}
+	if c.Run.Cmd == "" {
+		c.Run.Cmd = c.Build.Output
+		if !filepath.IsAbs(c.Run.Cmd) {
+			c.Run.Cmd = "./" + filepath.ToSlash(c.Run.Cmd)
+		}
+	}
+	if c.Run.StopSignal == "" {
+		c.Run.StopSignal = "SIGTERM"
+	}
+	sig, err := parseSignal(c.Run.StopSignal)
+	if err != nil {
+		return fmt.Errorf("run.stop_signal: %v", err)
+	}
+	c.Run.stopSignal = sig
+	c.Run.stopTimeout = 5 * time.Second
+	if c.Run.StopTimeout != "" {
+		d, err := time.ParseDuration(c.Run.StopTimeout)
+		if err != nil {
+			return fmt.Errorf("run.stop_timeout: %v", err)
+		}
+		c.Run.stopTimeout = d
+	}
+	if err := c.Run.initRestart(); err != nil {
+		return err
+	}
+	if c.Proxy.Target == "" {
+		c.Proxy.Target = "http://127.0.0.1:8080"
+	}
+	c.Proxy.holdTimeout = 30 * time.Second
+	if c.Proxy.HoldTimeout != "" {
+		d, err := time.ParseDuration(c.Proxy.HoldTimeout)
+		if err != nil {
+			return fmt.Errorf("proxy.hold_timeout: %v", err)
+		}
+		c.Proxy.holdTimeout = d
+	}
+	c.Release.init()
+	if err := c.Pack.init(); err != nil {
+		return err
+	}
+	if err := c.initProcesses(appname); err != nil {
+		return err
+	}
+	return c.Run.Ready.init(c.Proxy)
+}
+
+// initRestart fills the defaults of the restart policy.
+func (r *runConfig) initRestart() error {
+	if r.Restart == "" {
+		r.Restart = restartNever
+	}
+	if !validRestart(r.Restart) {
+		return fmt.Errorf("run.restart: invalid %q, use never, on-failure or always", r.Restart)
+	}
+	r.restartDelay = time.Second
+	if r.RestartDelay != "" {
+		d, err := time.ParseDuration(r.RestartDelay)
+		if err != nil {
+			return fmt.Errorf("run.restart_delay: %v", err)
+		}
+		r.restartDelay = d
+	}
+	if r.MaxRestarts <= 0 {
+		r.MaxRestarts = 5
+	}
+	if r.TailLines <= 0 {
+		r.TailLines = 20
+	}
+	return nil
+}
+
+// defaultWatchRules rebuilds the app for the go files, restarts it for the
+// config files and the templates, and reloads the browser pages for the static files.
+func defaultWatchRules() []watchRule {
+	return []watchRule{
+		{Glob: "*.go", Action: "rebuild"},
+		{Glob: "config/**", Action: "restart"},
+		{Glob: "view/**", Action: "restart"},
+		{Glob: "static/**", Action: "reload"},
+	}
+}
+
+// init fills the defaults.
+func (p *packConfig) init() error {
+	if p.Target == "" {
+		p.Target = hostTarget()
+	}
+	if p.Format == "" {
+		p.Format = "tar.gz"
+	}
+	if len(p.Include) == 0 {
+		p.Include = []string{"static", "view", "config"}
+	}
+	switch p.Format {
+	case "tar.gz", "zip":
+		return nil
+	}
+	return fmt.Errorf("pack.format: unsupported %q, use tar.gz or zip", p.Format)
+}
+
+func (r *releaseConfig) init() {
+	if len(r.Targets) == 0 {
+		r.Targets = []string{hostTarget()}
+	}
+	if r.Output == "" {
+		r.Output = "dist"
+	}
+	if r.VersionVar == "" {
+		r.VersionVar = "main.version"
+	}
+	if r.CommitVar == "" {
+		r.CommitVar = "main.commit"
+	}
+	if r.TimeVar == "" {
+		r.TimeVar = "main.buildTime"
+	}
+}
+
+// init compiles the checks. Without any check, the proxy target is probed
+// when the proxy is enabled.
+func (r *readyConfig) init(proxy proxyConfig) error {
+	if r.TCP == "" && r.HTTP == "" && r.Log == "" && proxy.Addr != "" {
+		u, err := url.Parse(proxy.Target)
+		if err != nil {
+			return fmt.Errorf("proxy.target: %v", err)
+		}
+		r.TCP = u.Host
+		if u.Port() == "" {
+			port := "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+			r.TCP = net.JoinHostPort(u.Hostname(), port)
+		}
+	}
+	if r.Log != "" {
+		re, err := regexp.Compile(r.Log)
+		if err != nil {
+			return fmt.Errorf("run.ready.log: %v", err)
+		}
+		r.log = re
+	}
+	r.timeout = 30 * time.Second
+	if r.Timeout != "" {
+		d, err := time.ParseDuration(r.Timeout)
+		if err != nil {
+			return fmt.Errorf("run.ready.timeout: %v", err)
+		}
+		r.timeout = d
+	}
+	return nil
+}
+
+// enabled returns whether any readiness check is configured.
+func (r *readyConfig) enabled() bool {
+	return r.TCP != "" || r.HTTP != "" || r.log != nil
+}
+
+// buildArgs returns the command line of the build, with `-o output` and the
+// flags right after the `build` word, so that the packages stay last,
+// e.g. `go build -o myapp -tags dev ./cmd/myapp`.
+func (c *fayConfig) buildArgs() []string {
+	fields := strings.Fields(c.Build.Cmd)
+	i := buildWordEnd(fields)
+	args := append([]string{}, fields[:i]...)
+	args = append(args, "-o", c.Build.Output)
+	args = append(args, c.Build.Flags...)
+	return append(args, fields[i:]...)
+}
+
+// releaseArgs returns the flags and the packages of the build command for
+// the release builds, e.g. `-tags dev ./cmd/myapp` of `go build -tags dev ./cmd/myapp`,
+// or nothing if it is not a go build.
+func (c *fayConfig) releaseArgs() []string {
+	fields := strings.Fields(c.Build.Cmd)
+	i := buildWordEnd(fields)
+	if i < 2 || strings.TrimSuffix(filepath.Base(fields[0]), ".exe") != "go" {
+		return nil
+	}
+	return append([]string{}, fields[i:]...)
+}
+
+// buildWordEnd returns the index after the `build` word of the command fields,
+// or the number of fields if there is none.
+func buildWordEnd(fields []string) int {
+	for i, field := range fields {
+		if field == "build" {
+			return i + 1
+		}
+	}
+	return len(fields)
+}
+
+// runArgs returns the command line of the app.
+func (c *fayConfig) runArgs() []string {
+	return append(strings.Fields(c.Run.Cmd), c.Run.Args...)
+}
+
+// environ returns environ with the configured variables appended.
+func (c *fayConfig) environ(environ []string) []string {
+	keys := make([]string, 0, len(c.Env))
+	for k := range c.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		environ = append(environ, k+"="+c.Env[k])
+	}
+	return environ
+}
+
+// runHooks runs the shell commands one by one and stops at the first failure.
+func runHooks(name string, hooks []string) error {
+	for _, hook := range hooks {
+		faygo.Printf("[fay] Hook %s: %s", name, hook)
+		cmd := shellCommand(hook)
+		cmd.Dir = curpath
+		cmd.Env = cfg.environ(os.Environ())
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("hook %s `%s`: %v", name, hook, err)
+		}
+	}
+	return nil
+}
+
+// shellCommand returns the command running the line with the shell.
+func shellCommand(line string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", line)
+	}
+	return exec.Command("sh", "-c", line)
+}
+
+// splitList splits a comma separated flag value.
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,182 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildArgs(t *testing.T) {
+	var cases = []struct {
+		cmd   string
+		flags []string
+		want  string
+	}{
+		{"go build", nil, "go build -o myapp"},
+		{"go build", []string{"-tags", "dev"}, "go build -o myapp -tags dev"},
+		// the packages stay last
+		{"go build ./cmd/myapp", []string{"-race"}, "go build -o myapp -race ./cmd/myapp"},
+		{"go build -v ./cmd/myapp", nil, "go build -o myapp -v ./cmd/myapp"},
+		{"make", []string{"-j2"}, "make -o myapp -j2"},
+	}
+	for _, c := range cases {
+		conf := &fayConfig{}
+		conf.Build.Cmd = c.cmd
+		conf.Build.Flags = c.flags
+		conf.Build.Output = "myapp"
+		if got := strings.Join(conf.buildArgs(), " "); got != c.want {
+			t.Errorf("%q %q: got %q, want %q", c.cmd, c.flags, got, c.want)
+		}
+	}
+}
+
+func TestConfigInit(t *testing.T) {
+	root, err := ioutil.TempDir("", "fay-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	// the main values of a config after init
+	type values struct {
+		exts          []string
+		delay         time.Duration
+		buildArgs     []string
+		runArgs       []string
+		restart       string
+		target        string
+		releaseOutput string
+		packFormat    string
+	}
+	defaults := values{
+		exts:          []string{".go"},
+		delay:         time.Second,
+		buildArgs:     []string{"go", "build", "-o", "myapp" + exe},
+		runArgs:       []string{"./myapp" + exe},
+		restart:       restartNever,
+		target:        "http://127.0.0.1:8080",
+		releaseOutput: "dist",
+		packFormat:    "tar.gz",
+	}
+	custom := values{
+		exts:          []string{".go", ".tpl"},
+		delay:         200 * time.Millisecond,
+		buildArgs:     []string{"go", "build", "-o", "bin/app", "-tags", "dev", "./cmd/app"},
+		runArgs:       []string{"./bin/app", "-port", "9090"},
+		restart:       "on-failure",
+		target:        "http://127.0.0.1:9090",
+		releaseOutput: "out",
+		packFormat:    "zip",
+	}
+	var cases = []struct {
+		file    string // the config file in the dir, empty for none
+		content string
+		want    values
+		err     string // a part of the error, empty for none
+	}{
+		{"", "", defaults, ""},
+		{"fay.yaml", "", defaults, ""},
+		{"fay.yaml", `
+watch: {exts: [go, .tpl], delay: 200ms}
+build: {cmd: go build ./cmd/app, flags: [-tags, dev], output: bin/app}
+run: {args: [-port, "9090"], restart: on-failure}
+proxy: {target: "http://127.0.0.1:9090"}
+release: {output: out}
+pack: {format: zip}
+`, custom, ""},
+		{"fay.toml", `
+[watch]
+exts = ["go", ".tpl"]
+delay = "200ms"
+[build]
+cmd = "go build ./cmd/app"
+flags = ["-tags", "dev"]
+output = "bin/app"
+[run]
+args = ["-port", "9090"]
+restart = "on-failure"
+[proxy]
+target = "http://127.0.0.1:9090"
+[release]
+output = "out"
+[pack]
+format = "zip"
+`, custom, ""},
+		{"fay.yaml", "watch: {delay: soon}", values{}, "watch.delay"},
+		{"fay.yaml", "watch: {rules: [{glob: '*.go', action: build}]}", values{}, "watch.rules"},
+		{"fay.yaml", "run: {restart: sometimes}", values{}, "run.restart"},
+		{"fay.yaml", "run: {stop_signal: SIGFOO}", values{}, "run.stop_signal"},
+		{"fay.yaml", "pack: {format: rar}", values{}, "pack.format"},
+		{"fay.yaml", "watch: [", values{}, "fay.yaml"},
+		{"fay.json", "{}", values{}, "unsupported config format"},
+	}
+	for i, c := range cases {
+		dir := filepath.Join(root, string(rune('a'+i)))
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			t.Fatal(err)
+		}
+		var filename string
+		if c.file != "" {
+			filename = filepath.Join(dir, c.file)
+			if err := ioutil.WriteFile(filename, []byte(c.content), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if c.file != "fay.json" {
+			// the supported names are found in the dir, the others must be given
+			filename = ""
+		}
+		conf, err := loadConfig(dir, filename)
+		if err == nil {
+			err = conf.init("myapp")
+		}
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("case %d: got error %v, want %q", i, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: %v", i, err)
+			continue
+		}
+		got := values{
+			exts:          conf.Watch.Exts,
+			delay:         conf.Watch.delay,
+			buildArgs:     conf.buildArgs(),
+			runArgs:       conf.runArgs(),
+			restart:       conf.Run.Restart,
+			target:        conf.Proxy.Target,
+			releaseOutput: conf.Release.Output,
+			packFormat:    conf.Pack.Format,
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("case %d: got %+v, want %+v", i, got, c.want)
+		}
+		if len(conf.Watch.Rules) == 0 || conf.Run.MaxRestarts != 5 || conf.Run.stopTimeout != 5*time.Second {
+			t.Errorf("case %d: missing defaults %+v %+v", i, conf.Watch.Rules, conf.Run)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/henrylee2cn/fay/generator"
+	"github.com/henrylee2cn/faygo"
+)
+
+// genapp generates the project code from an API spec file.
+func genapp(args []string) {
+	set := flag.NewFlagSet("gen", flag.ExitOnError)
+	set.Usage = genappHelp
+	swagger := set.Bool("swagger", false, "the file is a Swagger 2.0 document")
+	dir := set.String("dir", ".", "project dir of the Swagger 2.0 document")
+	name := set.String("app", "", "app name of the Swagger 2.0 document")
+	openapi := set.String("openapi", "", "write the OpenAPI 3 document instead of the code")
+	dryRun := set.Bool("dry-run", false, "print the diff of the files instead of writing them")
+	confirm := set.Bool("confirm", false, "print the diff of each changed file and ask before writing it")
+	args = parseInterspersed(set, args)
+	if len(args) != 1 {
+		genappHelp()
+		return
+	}
+	var m *generator.Main
+	var err error
+	if *swagger {
+		m, err = importSwagger(args[0], *dir, *name)
+	} else {
+		m, err = generator.LoadSpec(args[0])
+	}
+	if err != nil {
+		faygo.Fatalf("[fay] Load spec fail: %v", err)
+	}
+	if *openapi != "" {
+		if err = writeOpenAPI(m, *openapi); err != nil {
+			faygo.Fatalf("[fay] Generate OpenAPI document fail: %v", err)
+		}
+		faygo.Printf("[fay] Generate OpenAPI document was successful: %s", *openapi)
+		return
+	}
+	if *dryRun || *confirm {
+		if err = previewFiles(m, *confirm); err != nil {
+			faygo.Fatalf("[fay] Generate code fail: %v", err)
+		}
+		return
+	}
+	if err = m.Output(); err != nil {
+		faygo.Fatalf("[fay] Generate code fail: %v", err)
+	}
+	faygo.Printf("[fay] Generate was successful")
+}
+
+// previewFiles prints the diff of the changed files against the disk,
+// and if confirm, writes each of them the user agrees to.
+func previewFiles(m *generator.Main, confirm bool) error {
+	files, err := m.DryRun()
+	if err != nil {
+		return err
+	}
+	var changed, written int
+	for _, f := range files {
+		if !f.Changed() {
+			continue
+		}
+		changed++
+		fmt.Print(f.Diff())
+		if !confirm {
+			continue
+		}
+		faygo.Printf("[fay] Write %s? [yes|no]  ", f.Name)
+		if !askForConfirmation() {
+			continue
+		}
+		if err = f.Write(); err != nil {
+			return err
+		}
+		written++
+	}
+	if confirm {
+		faygo.Printf("[fay] %d of %d changed files were written", written, changed)
+	} else {
+		faygo.Printf("[fay] %d of %d files would be changed", changed, len(files))
+	}
+	return nil
+}
+
+// writeOpenAPI writes the OpenAPI 3 document, in YAML if the extension is
+// `.yaml` or `.yml`, else in JSON.
+func writeOpenAPI(m *generator.Main, filename string) error {
+	doc, err := m.OpenAPI()
+	if err != nil {
+		return err
+	}
+	var data []byte
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		data, err = doc.YAML()
+	default:
+		data, err = doc.JSON()
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0666)
+}
+
+// importSwagger creates the project of the Swagger 2.0 document in dir,
+// with the router in `router` and the handlers in `handler`.
+func importSwagger(filename, dir, name string) (*generator.Main, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = filepath.Base(dir)
+	}
+	router, warnings, err := generator.ImportSwagger(data, "Route", filepath.Join(dir, "router"), filepath.Join(dir, "handler"))
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range warnings {
+		faygo.Warningf("[fay] %s", warning)
+	}
+	m, err := generator.NewMain(dir)
+	if err != nil {
+		return nil, err
+	}
+	return m, m.AddFrame(router, name)
+}
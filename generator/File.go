@@ -0,0 +1,246 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/henrylee2cn/faygo"
+)
+
+// File a generated file computed in memory
+type File struct {
+	Name    string // full file name
+	Content []byte // generated content, formatted for the go files
+	Old     []byte // content on disk, nil if the file does not exist
+}
+
+// newFile computes the file and reads the one on disk.
+func newFile(dir, shortname, code string) (*File, error) {
+	f := &File{
+		Name:    path.Join(dir, shortname),
+		Content: []byte(code),
+	}
+	if filepath.Ext(shortname) == ".go" {
+		src, err := format.Source(f.Content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		f.Content = src
+	}
+	old, err := ioutil.ReadFile(f.Name)
+	switch {
+	case err == nil:
+		if old == nil {
+			old = []byte{}
+		}
+		f.Old = old
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	return f, nil
+}
+
+// IsNew returns whether the file does not exist on disk.
+func (f *File) IsNew() bool {
+	return f.Old == nil
+}
+
+// Changed returns whether the file is new or differs from the one on disk.
+func (f *File) Changed() bool {
+	return f.Old == nil || !bytes.Equal(f.Old, f.Content)
+}
+
+// Write writes the file to disk, and logs whether it was created or updated.
+// An unchanged file is not written, so that its modification time is kept.
+func (f *File) Write() error {
+	if !f.Changed() {
+		faygo.Printf("[fay] Unchanged %s", f.Name)
+		return nil
+	}
+	err := os.MkdirAll(path.Dir(f.Name), 0777)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(f.Name, f.Content, 0666)
+	if err != nil {
+		return err
+	}
+	if f.IsNew() {
+		faygo.Printf("[fay] Created %s", f.Name)
+	} else {
+		faygo.Printf("[fay] Updated %s", f.Name)
+	}
+	return nil
+}
+
+// writeFiles writes the files to disk.
+func writeFiles(files []*File) error {
+	for _, f := range files {
+		if err := f.Write(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uniqueFiles removes the files computed more than once, e.g. a middleware
+// of several nodes, the last one wins.
+func uniqueFiles(files []*File) []*File {
+	index := make(map[string]int, len(files))
+	var unique []*File
+	for _, f := range files {
+		if i, ok := index[f.Name]; ok {
+			unique[i] = f
+			continue
+		}
+		index[f.Name] = len(unique)
+		unique = append(unique, f)
+	}
+	return unique
+}
+
+// diffContext the number of unchanged lines around the changes
+const diffContext = 3
+
+type diffLine struct {
+	op   byte // ' ', '-' or '+'
+	text string
+}
+
+// Diff returns the unified diff of the file on disk and the generated file,
+// empty if they are the same.
+func (f *File) Diff() string {
+	if !f.Changed() {
+		return ""
+	}
+	oldName := f.Name
+	if f.IsNew() {
+		oldName = "/dev/null"
+	}
+	lines := diffLines(splitLines(string(f.Old)), splitLines(string(f.Content)))
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldName, f.Name)
+
+	// the old and new line numbers before each line
+	oldPos := make([]int, len(lines)+1)
+	newPos := make([]int, len(lines)+1)
+	for i, l := range lines {
+		oldPos[i+1], newPos[i+1] = oldPos[i], newPos[i]
+		if l.op != '+' {
+			oldPos[i+1]++
+		}
+		if l.op != '-' {
+			newPos[i+1]++
+		}
+	}
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i++
+			continue
+		}
+		// extend the hunk while the next change is close enough
+		last := i
+		for j := i + 1; j < len(lines) && j <= last+2*diffContext; j++ {
+			if lines[j].op != ' ' {
+				last = j
+			}
+		}
+		start, end := i-diffContext, last+diffContext+1
+		if start < 0 {
+			start = 0
+		}
+		if end > len(lines) {
+			end = len(lines)
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n",
+			hunkRange(oldPos[start], oldPos[end]-oldPos[start]),
+			hunkRange(newPos[start], newPos[end]-newPos[start]),
+		)
+		for _, l := range lines[start:end] {
+			buf.WriteByte(l.op)
+			buf.WriteString(l.text)
+			if !strings.HasSuffix(l.text, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return buf.String()
+}
+
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+// splitLines splits s after each newline.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the edit script of a to b by the longest common subsequence.
+func diffLines(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var lines []diffLine
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case i == n || (j < m && lcs[i][j+1] > lcs[i+1][j]):
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		default:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		}
+	}
+	return lines
+}
@@ -0,0 +1,163 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileDiff(t *testing.T) {
+	var cases = []struct {
+		old  []byte
+		new  string
+		want string
+	}{
+		{nil, "a\nb\n", "--- /dev/null\n+++ f\n@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{[]byte("a\nb\n"), "a\nb\n", ""},
+		{[]byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n"), "1\n2\n3\n4\nx\n6\n7\n8\n9\n",
+			"--- f\n+++ f\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+x\n 6\n 7\n 8\n"},
+		// the changes far apart are split into two hunks
+		{[]byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"), "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			"--- f\n+++ f\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -7,4 +8,3 @@\n 7\n 8\n 9\n-10\n"},
+		{[]byte("a"), "b\n", "--- f\n+++ f\n@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+b\n"},
+	}
+	for i, c := range cases {
+		f := &File{Name: "f", Content: []byte(c.new), Old: c.old}
+		if got := f.Diff(); got != c.want {
+			t.Errorf("case %d: got diff\n%s\nwant\n%s", i, got, c.want)
+		}
+	}
+}
+
+func TestFileWrite(t *testing.T) {
+	root, err := ioutil.TempDir("", "fay-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	var cases = []struct {
+		name    string
+		old     string // the content on disk, empty for none
+		content string
+		written bool
+	}{
+		{"new.txt", "", "a\n", true},
+		{"dir/new.txt", "", "a\n", true},
+		{"changed.txt", "a\n", "b\n", true},
+		{"unchanged.txt", "a\n", "a\n", false},
+	}
+	for _, c := range cases {
+		name := filepath.Join(root, filepath.FromSlash(c.name))
+		if c.old != "" {
+			if err := ioutil.WriteFile(name, []byte(c.old), 0666); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(name, past, past); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f, err := newFile(filepath.Dir(name), filepath.Base(name), c.content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = f.Write(); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(name)
+		if err != nil || string(b) != c.content {
+			t.Errorf("%s: got content %q, %v, want %q", c.name, b, err, c.content)
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if written := !fi.ModTime().Equal(past); written != c.written {
+			t.Errorf("%s: got written %v, want %v", c.name, written, c.written)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	root := tempModule(t)
+	defer os.RemoveAll(root)
+	spec, err := ParseSpec([]byte(`
+frames:
+  - name: myapp
+    router:
+      func: Route
+      dir: router
+      handlers:
+        - {name: Index, type: func, dir: handler, url: /, method: GET}
+      middlewares:
+        - {name: Token, dir: middleware, url: /}
+`), ".yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := spec.Main(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := m.DryRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		if !f.IsNew() || !f.Changed() {
+			t.Errorf("%s: want a new file", f.Name)
+		}
+		names = append(names, strings.TrimPrefix(f.Name, root+"/"))
+	}
+	want := "main.go router/route.go handler/index.go middleware/token.go"
+	if strings.Join(names, " ") != want {
+		t.Fatalf("got files %v, want %s", names, want)
+	}
+	if _, err = os.Stat(filepath.Join(root, "main.go")); !os.IsNotExist(err) {
+		t.Fatalf("dry run wrote main.go: %v", err)
+	}
+
+	// the edited doc of the handler is reported, not overwritten
+	if err = m.Output(); err != nil {
+		t.Fatal(err)
+	}
+	index := filepath.Join(root, "handler", "index.go")
+	edited := strings.Replace(string(files[2].Content), "Index", "Index edited", 1)
+	if err = ioutil.WriteFile(index, []byte(edited), 0666); err != nil {
+		t.Fatal(err)
+	}
+	files, err = m.DryRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if f.Changed() != (f.Name == index) {
+			t.Errorf("%s: changed %v", f.Name, f.Changed())
+		}
+	}
+	if diff := files[2].Diff(); !strings.Contains(diff, "-Index edited\n+Index\n") {
+		t.Errorf("unexpected diff\n%s", diff)
+	}
+	if b, _ := ioutil.ReadFile(index); string(b) != edited {
+		t.Errorf("dry run overwrote %s", index)
+	}
+}
@@ -41,11 +41,20 @@ type (
 
 // Output creates struct handler file.
 func (s *FuncHandler) Output() error {
-	code, err := s.Create()
+	f, err := s.DryRun()
 	if err != nil {
 		return err
 	}
-	return writeFile(s.Dir, faygo.SnakeString(s.Name)+".go", code)
+	return f.Write()
+}
+
+// DryRun returns func handler file without writing it.
+func (s *FuncHandler) DryRun() (*File, error) {
+	code, err := s.Create()
+	if err != nil {
+		return nil, err
+	}
+	return newHandlerFile(s.Dir, faygo.SnakeString(s.Name)+".go", code)
 }
 
 // Create returns struct handler's codes
@@ -92,15 +101,11 @@ func (s *FuncHandler) TryMainPkg(mainPkgPath string) {
 }
 
 // PkgPath returns the package path, e.g `github.com/henrylee2cn/fay/test`
-func (s *FuncHandler) PkgPath() string {
+func (s *FuncHandler) PkgPath() (string, error) {
 	if s.isMainPkg || s.Dir == "" {
-		return ""
-	}
-	dirs := strings.Split(s.Dir, "/src/")
-	if len(dirs) < 2 {
-		faygo.Fatalf("You must generate codes in the `src` or its offspring directory!")
+		return "", nil
 	}
-	return strings.Join(dirs[1:], "/src/")
+	return ImportPath(s.Dir)
 }
 
 // PkgName returns the package name, e.g `handler`
@@ -73,7 +73,11 @@ func (m *Main) AddFrame(router *Router, frame string, version ...string) error {
 		router:  router,
 	}
 	if router.dir != m.dir {
-		m.importmap[router.PkgPath()] = true
+		pkg, err := router.PkgPath()
+		if err != nil {
+			return err
+		}
+		m.importmap[pkg] = true
 		newframe.pkgPrefix = router.PkgPrefix()
 	} else {
 		router.TryMainPkg(m.dir)
@@ -84,17 +88,28 @@ func (m *Main) AddFrame(router *Router, frame string, version ...string) error {
 
 // Output returns main's file.
 func (m *Main) Output() error {
-	err := writeFile(m.dir, "main.go", m.Create())
+	files, err := m.DryRun()
 	if err != nil {
 		return err
 	}
+	return writeFiles(files)
+}
+
+// DryRun returns main's file and the files of the routers without writing them.
+func (m *Main) DryRun() ([]*File, error) {
+	f, err := newFile(m.dir, "main.go", m.Create())
+	if err != nil {
+		return nil, err
+	}
+	var files = []*File{f}
 	for _, frame := range m.frames {
-		err = frame.router.Output()
+		routerFiles, err := frame.router.DryRun()
 		if err != nil {
-			return err
+			return nil, err
 		}
+		files = append(files, routerFiles...)
 	}
-	return nil
+	return uniqueFiles(files), nil
 }
 
 // Create returns main's codes.
@@ -0,0 +1,464 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// newHandlerFile computes the handler file, and merges the code written by hand
+// in the file on disk into it.
+func newHandlerFile(dir, shortname, code string) (*File, error) {
+	f, err := newFile(dir, shortname, code)
+	if err != nil || f.IsNew() {
+		return f, err
+	}
+	merged, err := mergeHandler(f.Content, f.Old)
+	if err != nil {
+		return nil, fmt.Errorf("%s: can not merge the code on disk: %v", f.Name, err)
+	}
+	f.Content = merged
+	return f, nil
+}
+
+// codeEdit replaces src[start:end] with text.
+type codeEdit struct {
+	start, end int
+	text       string
+}
+
+// mergeHandler merges the handler code on disk into the generated code:
+//   - the types, the docs and the `Doc` methods are the generated ones,
+//     but the struct fields written by hand are kept;
+//   - the funcs and methods, and the func literals of the vars, keep the old bodies,
+//     except a `Serve` body which is the generated one for the old fields;
+//   - the other declarations on disk are appended;
+//   - the imports are the union of both, without the ones no longer used.
+func mergeHandler(gen, old []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	genFile, err := parser.ParseFile(fset, "generated.go", gen, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	oldFile, err := parser.ParseFile(fset, "old.go", old, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	offset := func(pos token.Pos) int {
+		return fset.Position(pos).Offset
+	}
+	oldSrc := func(from, to ast.Node) string {
+		return string(old[offset(from.Pos()):offset(to.End())])
+	}
+
+	oldDecls := make(map[string]ast.Decl)
+	for _, decl := range oldFile.Decls {
+		for _, key := range declKeys(decl) {
+			oldDecls[key] = decl
+		}
+	}
+	var edits []codeEdit
+	generated := make(map[string]bool)
+	for _, decl := range genFile.Decls {
+		for _, key := range declKeys(decl) {
+			generated[key] = true
+		}
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			oldFunc, ok := oldDecls[declKeys(d)[0]].(*ast.FuncDecl)
+			if !ok || d.Name.Name == "Doc" || oldFunc.Body == nil {
+				continue
+			}
+			if isGeneratedServe(oldFunc, oldDecls, oldSrc) {
+				continue
+			}
+			// keep the old signature too, the body may use the receiver name,
+			// `Type` starts at the func keyword and leaves out the doc
+			edits = append(edits, codeEdit{offset(d.Type.Pos()), offset(d.End()), oldSrc(oldFunc.Type, oldFunc)})
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.ValueSpec:
+					oldDecl, ok := oldDecls[s.Names[0].Name].(*ast.GenDecl)
+					if !ok {
+						continue
+					}
+					genLit, oldLit := firstFuncLit(s), firstFuncLit(findSpec(oldDecl, s.Names[0].Name))
+					if genLit != nil && oldLit != nil {
+						edits = append(edits, codeEdit{offset(genLit.Pos()), offset(genLit.End()), oldSrc(oldLit, oldLit)})
+					}
+				case *ast.TypeSpec:
+					oldDecl, ok := oldDecls[s.Name.Name].(*ast.GenDecl)
+					if !ok {
+						continue
+					}
+					if kept := keptFields(s, findSpec(oldDecl, s.Name.Name), oldSrc); kept != "" {
+						closing := offset(s.Type.(*ast.StructType).Fields.Closing)
+						edits = append(edits, codeEdit{closing, closing, kept})
+					}
+				}
+			}
+		}
+	}
+
+	// the imports and the declarations written by hand
+	var imports, decls []string
+	genImports := make(map[string]bool)
+	for _, imp := range genFile.Imports {
+		genImports[imp.Path.Value] = true
+	}
+	for _, imp := range oldFile.Imports {
+		if !genImports[imp.Path.Value] {
+			imports = append(imports, oldSrc(imp, imp))
+		}
+	}
+	for _, decl := range oldFile.Decls {
+		if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+			continue
+		}
+		if isGenerated(decl, generated) {
+			continue
+		}
+		var from ast.Node = decl
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Doc != nil {
+				from = d.Doc
+			}
+		case *ast.GenDecl:
+			if d.Doc != nil {
+				from = d.Doc
+			}
+		}
+		decls = append(decls, oldSrc(from, decl))
+	}
+	if len(imports) > 0 {
+		edit, err := importEdit(genFile, imports, offset)
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, edit)
+	}
+
+	src := applyEdits(string(gen), edits)
+	for _, decl := range decls {
+		src = strings.TrimRight(src, "\n") + "\n\n" + decl + "\n"
+	}
+	merged, err := format.Source([]byte(src))
+	if err != nil {
+		return nil, err
+	}
+	return removeUnusedImports(merged)
+}
+
+// applyEdits applies the edits, which do not overlap, to src.
+func applyEdits(src string, edits []codeEdit) string {
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	for _, e := range edits {
+		src = src[:e.start] + e.text + src[e.end:]
+	}
+	return src
+}
+
+// declKeys returns the names of the declaration, `Type.Method` for the methods.
+func declKeys(decl ast.Decl) []string {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Recv != nil && len(d.Recv.List) > 0 {
+			return []string{recvTypeName(d.Recv.List[0].Type) + "." + d.Name.Name}
+		}
+		return []string{d.Name.Name}
+	case *ast.GenDecl:
+		var keys []string
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				keys = append(keys, s.Name.Name)
+			case *ast.ValueSpec:
+				for _, name := range s.Names {
+					keys = append(keys, name.Name)
+				}
+			}
+		}
+		return keys
+	}
+	return nil
+}
+
+func recvTypeName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// isGenerated returns whether the old decl is replaced by the generated code,
+// including the `Doc` method of a generated type, which goes with the note and the return.
+func isGenerated(decl ast.Decl, generated map[string]bool) bool {
+	for _, key := range declKeys(decl) {
+		if generated[key] {
+			return true
+		}
+	}
+	d, ok := decl.(*ast.FuncDecl)
+	return ok && d.Name.Name == "Doc" && d.Recv != nil && len(d.Recv.List) > 0 &&
+		generated[recvTypeName(d.Recv.List[0].Type)]
+}
+
+func findSpec(decl *ast.GenDecl, name string) ast.Spec {
+	for _, spec := range decl.Specs {
+		switch s := spec.(type) {
+		case *ast.TypeSpec:
+			if s.Name.Name == name {
+				return s
+			}
+		case *ast.ValueSpec:
+			for _, ident := range s.Names {
+				if ident.Name == name {
+					return s
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func firstFuncLit(n ast.Node) *ast.FuncLit {
+	if n == nil {
+		return nil
+	}
+	var lit *ast.FuncLit
+	ast.Inspect(n, func(n ast.Node) bool {
+		if l, ok := n.(*ast.FuncLit); ok && lit == nil {
+			lit = l
+		}
+		return lit == nil
+	})
+	return lit
+}
+
+// keptFields returns the old struct fields that are not request params,
+// e.g. the fields used by the hand-written Serve.
+func keptFields(gen *ast.TypeSpec, old ast.Spec, oldSrc func(from, to ast.Node) string) string {
+	oldType, ok := old.(*ast.TypeSpec)
+	if !ok {
+		return ""
+	}
+	genStruct, ok1 := gen.Type.(*ast.StructType)
+	oldStruct, ok2 := oldType.Type.(*ast.StructType)
+	if !ok1 || !ok2 {
+		return ""
+	}
+	names := make(map[string]bool)
+	for _, field := range genStruct.Fields.List {
+		for _, name := range field.Names {
+			names[name.Name] = true
+		}
+	}
+	fileParams, filesParams := uploadParams(oldStruct, oldSrc)
+	for _, name := range fileParams {
+		names[name+"Url"] = true
+	}
+	for _, name := range filesParams {
+		names[name+"Urls"] = true
+	}
+	var kept string
+	for _, field := range oldStruct.Fields.List {
+		// the params and the generated fields of their uploaded files
+		if isInParam(field) || len(field.Names) == 0 || names[field.Names[0].Name] {
+			continue
+		}
+		var from, to ast.Node = field, field
+		if field.Doc != nil {
+			from = field.Doc
+		}
+		if field.Comment != nil {
+			to = field.Comment
+		}
+		kept += "\n" + oldSrc(from, to)
+	}
+	if kept == "" {
+		return ""
+	}
+	return kept + "\n"
+}
+
+// isInParam returns whether the field is a request param, with the `in` param tag.
+func isInParam(field *ast.Field) bool {
+	if field.Tag == nil {
+		return false
+	}
+	tag, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return false
+	}
+	return strings.Contains(reflect.StructTag(tag).Get("param"), "<in:")
+}
+
+// uploadParams returns the names of the uploaded file params of the struct,
+// of a single file and of several files.
+func uploadParams(st *ast.StructType, oldSrc func(from, to ast.Node) string) (fileParams, filesParams []string) {
+	for _, field := range st.Fields.List {
+		if !isInParam(field) || len(field.Names) == 0 {
+			continue
+		}
+		switch oldSrc(field.Type, field.Type) {
+		case "*multipart.FileHeader", "multipart.FileHeader":
+			fileParams = append(fileParams, field.Names[0].Name)
+		case "[]*multipart.FileHeader", "[]multipart.FileHeader":
+			filesParams = append(filesParams, field.Names[0].Name)
+		}
+	}
+	return
+}
+
+// isGeneratedServe returns whether the old func is the `Serve` method generated
+// for the old struct fields, not edited by hand, so that it follows the new fields.
+func isGeneratedServe(oldFunc *ast.FuncDecl, oldDecls map[string]ast.Decl, oldSrc func(from, to ast.Node) string) bool {
+	if oldFunc.Name.Name != "Serve" || oldFunc.Recv == nil || len(oldFunc.Recv.List) == 0 || len(oldFunc.Recv.List[0].Names) == 0 {
+		return false
+	}
+	typeName := recvTypeName(oldFunc.Recv.List[0].Type)
+	oldDecl, ok := oldDecls[typeName].(*ast.GenDecl)
+	if !ok {
+		return false
+	}
+	oldType, ok := findSpec(oldDecl, typeName).(*ast.TypeSpec)
+	if !ok {
+		return false
+	}
+	st, ok := oldType.Type.(*ast.StructType)
+	if !ok {
+		return false
+	}
+	fileParams, filesParams := uploadParams(st, oldSrc)
+	body := oldSrc(oldFunc.Body, oldFunc.Body)
+	return sameTokens(body[1:len(body)-1], serveCode(oldFunc.Recv.List[0].Names[0].Name, fileParams, filesParams))
+}
+
+// sameTokens returns whether the code snippets have the same tokens and comments.
+func sameTokens(a, b string) bool {
+	tokens := func(src string) []string {
+		var s scanner.Scanner
+		fset := token.NewFileSet()
+		s.Init(fset.AddFile("", -1, len(src)), []byte(src), nil, scanner.ScanComments)
+		var list []string
+		for {
+			_, tok, lit := s.Scan()
+			if tok == token.EOF {
+				return list
+			}
+			// the semicolons of the line ends
+			if tok == token.SEMICOLON && lit == "\n" {
+				continue
+			}
+			list = append(list, tok.String()+" "+lit)
+		}
+	}
+	return reflect.DeepEqual(tokens(a), tokens(b))
+}
+
+// removeUnusedImports removes the imports the code does not refer to, only if
+// their package name is known: named, or the last element of the import path.
+func removeUnusedImports(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "merged.go", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok {
+				used[x.Name] = true
+			}
+		}
+		return true
+	})
+	unused := func(spec *ast.ImportSpec) bool {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return false
+		}
+		name := path.Base(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		return name != "_" && name != "." && token.IsIdentifier(name) && !used[name]
+	}
+	offset := func(pos token.Pos) int {
+		return fset.Position(pos).Offset
+	}
+	var edits []codeEdit
+	for _, decl := range f.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT {
+			continue
+		}
+		var removed []codeEdit
+		for _, spec := range d.Specs {
+			spec := spec.(*ast.ImportSpec)
+			if !unused(spec) {
+				continue
+			}
+			var from, to ast.Node = spec, spec
+			if spec.Doc != nil {
+				from = spec.Doc
+			}
+			if spec.Comment != nil {
+				to = spec.Comment
+			}
+			removed = append(removed, codeEdit{offset(from.Pos()), offset(to.End()), ""})
+		}
+		if len(removed) == len(d.Specs) && len(removed) > 0 {
+			removed = []codeEdit{{offset(d.Pos()), offset(d.End()), ""}}
+		}
+		edits = append(edits, removed...)
+	}
+	if len(edits) == 0 {
+		return src, nil
+	}
+	return format.Source([]byte(applyEdits(string(src), edits)))
+}
+
+// importEdit returns the edit adding the import specs to the generated imports.
+func importEdit(f *ast.File, imports []string, offset func(token.Pos) int) (codeEdit, error) {
+	for _, decl := range f.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT {
+			continue
+		}
+		if !d.Rparen.IsValid() {
+			end := offset(d.End())
+			return codeEdit{end, end, "\nimport (\n" + strings.Join(imports, "\n") + "\n)"}, nil
+		}
+		rparen := offset(d.Rparen)
+		return codeEdit{rparen, rparen, strings.Join(imports, "\n") + "\n"}, nil
+	}
+	return codeEdit{}, fmt.Errorf("no import declaration")
+}
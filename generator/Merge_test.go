@@ -0,0 +1,196 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMergeHandler(t *testing.T) {
+	root := tempModule(t)
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "handler")
+	login := &StructHandler{
+		Dir:    dir,
+		Name:   "Login",
+		Method: "POST",
+		Fields: []Field{
+			{Type: "string", Name: "Name", In: "formData"},
+			{Type: "string", Name: "Password", In: "formData"},
+		},
+		Note:   "user login",
+		Return: "{}",
+	}
+	if err := login.Output(); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "login.go")
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the code written by hand
+	code := strings.Replace(string(b), "\treturn ctx.JSON(200, l, true)", "\tif !check(l.Name, l.Password) {\n\t\treturn errors.New(\"denied\")\n\t}\n\treturn ctx.JSON(200, l.session, true)", 1)
+	code = strings.Replace(code, "\"github.com/henrylee2cn/faygo\"", "\"errors\"\n\n\t\"github.com/henrylee2cn/faygo\"", 1)
+	code = strings.Replace(code, "`param:\"<in:formData>\"`\n}", "`param:\"<in:formData>\"`\n\t// set by Serve\n\tsession string\n}", 1)
+	code += "\n// check checks the password.\nfunc check(name, password string) bool {\n\treturn name != \"\"\n}\n"
+	if err = ioutil.WriteFile(filename, []byte(code), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// the spec changes the fields and the note
+	login.Fields = []Field{
+		{Type: "string", Name: "Name", In: "formData", Required: true},
+		{Type: "string", Name: "Code", In: "query"},
+	}
+	login.Note = "user login by code"
+	if err = login.Output(); err != nil {
+		t.Fatal(err)
+	}
+	b, err = ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(b)
+	for _, want := range []string{
+		"\"errors\"",
+		"Login user login by code",
+		"`param:\"<in:formData><required>\"`",
+		"`param:\"<in:query>\"`",
+		"// set by Serve\n\tsession string\n}",
+		"return errors.New(\"denied\")",
+		"return ctx.JSON(200, l.session, true)",
+		"Note:   \"user login by code\"",
+		"// check checks the password.\nfunc check(",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("merged code lacks %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "Password string") || strings.Count(got, "func (l *Login) Serve") != 1 {
+		t.Errorf("unexpected merged code:\n%s", got)
+	}
+
+	// a func handler keeps its body, and its doc follows the note
+	index := &FuncHandler{Dir: dir, Name: "Index", Method: "GET"}
+	if err = index.Output(); err != nil {
+		t.Fatal(err)
+	}
+	filename = filepath.Join(dir, "index.go")
+	b, _ = ioutil.ReadFile(filename)
+	code = strings.Replace(string(b), "return nil", "return ctx.String(200, \"hi\")", 1)
+	ioutil.WriteFile(filename, []byte(code), 0666)
+	index.Note = "home page"
+	if err = index.Output(); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadFile(filename)
+	got = string(b)
+	if !strings.Contains(got, "faygo.WrapDoc(") || !strings.Contains(got, "return ctx.String(200, \"hi\")") {
+		t.Errorf("unexpected merged code:\n%s", got)
+	}
+}
+
+func TestMergeHandlerRemovedField(t *testing.T) {
+	root := tempModule(t)
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "handler")
+	upload := &StructHandler{
+		Dir:    dir,
+		Name:   "Upload",
+		Method: "POST",
+		Fields: []Field{
+			{Type: "string", Name: "Title", In: "formData"},
+			{Type: "*multipart.FileHeader", Name: "Img", In: "formData"},
+		},
+	}
+	if err := upload.Output(); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "upload.go")
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a field and an import written by hand
+	code := strings.Replace(string(b), "\"github.com/henrylee2cn/faygo\"", "\"github.com/henrylee2cn/faygo\"\n\t\"time\"", 1)
+	code = strings.Replace(code, "`param:\"-\"`\n}", "`param:\"-\"`\n\tCreated time.Time `param:\"-\"`\n}", 1)
+	if err = ioutil.WriteFile(filename, []byte(code), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// the spec removes the uploaded file
+	upload.Fields = upload.Fields[:1]
+	if err = upload.Output(); err != nil {
+		t.Fatal(err)
+	}
+	b, err = ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(b)
+	for _, stale := range []string{"mime/multipart", "ImgUrl", "SaveFile"} {
+		if strings.Contains(got, stale) {
+			t.Errorf("merged code keeps the stale %q:\n%s", stale, got)
+		}
+	}
+	for _, want := range []string{"\"time\"", "Created time.Time", "return ctx.JSON(200, u, true)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("merged code lacks %q:\n%s", want, got)
+		}
+	}
+	if _, err = parser.ParseFile(token.NewFileSet(), filename, b, 0); err != nil {
+		t.Errorf("merged code: %v", err)
+	}
+}
+
+func TestRemoveUnusedImports(t *testing.T) {
+	src := `package handler
+
+import (
+	"errors"
+	// the uploads
+	"mime/multipart"
+	y "gopkg.in/yaml.v2"
+	_ "image/png"
+	"github.com/mattn/go-sqlite3"
+	"gopkg.in/yaml.v3"
+)
+
+import "net/http"
+
+var err = errors.New("x")
+`
+	got, err := removeUnusedImports([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"errors"`, `_ "image/png"`, `"github.com/mattn/go-sqlite3"`, `"gopkg.in/yaml.v3"`} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("lacks %s:\n%s", want, got)
+		}
+	}
+	for _, unused := range []string{"multipart", "the uploads", `y "gopkg.in/yaml.v2"`, "net/http"} {
+		if strings.Contains(string(got), unused) {
+			t.Errorf("keeps %s:\n%s", unused, got)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ImportPath returns the import path of the package in dir.
+// The enclosing go.mod is preferred, and the GOPATH `/src/` layout is the fallback.
+// dir does not have to exist yet.
+func ImportPath(dir string) (string, error) {
+	err := cleanDir(&dir)
+	if err != nil {
+		return "", err
+	}
+	modDir, modPath, err := findModule(dir)
+	if err != nil {
+		return "", err
+	}
+	if modDir != "" {
+		rel := strings.TrimPrefix(strings.TrimPrefix(dir, modDir), "/")
+		if rel == "" {
+			return modPath, nil
+		}
+		return modPath + "/" + rel, nil
+	}
+	dirs := strings.Split(dir, "/src/")
+	if len(dirs) < 2 {
+		return "", errors.New("Can not work out the import path of " + dir + ": no go.mod was found and it is not under the GOPATH `src` directory.")
+	}
+	return strings.Join(dirs[1:], "/src/"), nil
+}
+
+// findModule returns the directory and module path of the nearest go.mod above dir.
+// If there is no go.mod, modDir is empty.
+func findModule(dir string) (modDir, modPath string, err error) {
+	for {
+		filename := path.Join(dir, "go.mod")
+		data, err := ioutil.ReadFile(filename)
+		if err == nil {
+			modPath = parseModulePath(data)
+			if modPath == "" {
+				return "", "", errors.New("No module path is declared in " + filename)
+			}
+			return dir, modPath, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", "", err
+		}
+		parent := path.Dir(dir)
+		if parent == dir || parent == "." {
+			return "", "", nil
+		}
+		dir = parent
+	}
+}
+
+// parseModulePath returns the path of the `module` directive in go.mod data.
+func parseModulePath(data []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "module" {
+			continue
+		}
+		line = strings.TrimSpace(line[len("module"):])
+		if unquoted, err := strconv.Unquote(line); err == nil {
+			return unquoted
+		}
+		return line
+	}
+	return ""
+}
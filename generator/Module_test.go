@@ -0,0 +1,44 @@
+package generator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportPath(t *testing.T) {
+	root, err := ioutil.TempDir("", "fay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	modRoot := filepath.Join(root, "app")
+	os.MkdirAll(modRoot, 0777)
+	err = ioutil.WriteFile(filepath.Join(modRoot, "go.mod"), []byte("// app\nmodule \"example.com/app\" // comment\n\ngo 1.20\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases = []struct {
+		dir  string
+		want string
+	}{
+		{modRoot, "example.com/app"},
+		{filepath.Join(modRoot, "router"), "example.com/app/router"},
+		{filepath.Join(modRoot, "api", "handler"), "example.com/app/api/handler"},
+		{filepath.Join(root, "gopath", "src", "github.com", "a", "b"), "github.com/a/b"},
+	}
+	for _, c := range cases {
+		got, err := ImportPath(c.dir)
+		if err != nil {
+			t.Fatalf("ImportPath(%q): %v", c.dir, err)
+		}
+		if got != c.want {
+			t.Errorf("ImportPath(%q) = %q, want %q", c.dir, got, c.want)
+		}
+	}
+	if _, err = ImportPath(filepath.Join(root, "nowhere")); err == nil {
+		t.Errorf("ImportPath outside of a module and GOPATH should fail")
+	}
+}
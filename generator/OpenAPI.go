@@ -0,0 +1,391 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/henrylee2cn/faygo"
+	"gopkg.in/yaml.v2"
+)
+
+type (
+	// OpenAPI OpenAPI 3 document
+	OpenAPI struct {
+		OpenAPI string                                  `json:"openapi" yaml:"openapi"`
+		Info    openAPIInfo                             `json:"info" yaml:"info"`
+		Paths   map[string]map[string]*openAPIOperation `json:"paths" yaml:"paths"`
+	}
+	openAPIInfo struct {
+		Title   string `json:"title" yaml:"title"`
+		Version string `json:"version" yaml:"version"`
+	}
+	openAPIOperation struct {
+		OperationID string                      `json:"operationId" yaml:"operationId"`
+		Summary     string                      `json:"summary,omitempty" yaml:"summary,omitempty"`
+		Description string                      `json:"description,omitempty" yaml:"description,omitempty"`
+		Parameters  []*openAPIParameter         `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+		RequestBody *openAPIRequestBody         `json:"requestBody,omitempty" yaml:"requestBody,omitempty"`
+		Responses   map[string]*openAPIResponse `json:"responses" yaml:"responses"`
+	}
+	openAPIParameter struct {
+		Name        string         `json:"name" yaml:"name"`
+		In          string         `json:"in" yaml:"in"`
+		Description string         `json:"description,omitempty" yaml:"description,omitempty"`
+		Required    bool           `json:"required,omitempty" yaml:"required,omitempty"`
+		Schema      *openAPISchema `json:"schema" yaml:"schema"`
+	}
+	openAPIRequestBody struct {
+		Required bool                         `json:"required,omitempty" yaml:"required,omitempty"`
+		Content  map[string]*openAPIMediaType `json:"content" yaml:"content"`
+	}
+	openAPIResponse struct {
+		Description string                       `json:"description" yaml:"description"`
+		Content     map[string]*openAPIMediaType `json:"content,omitempty" yaml:"content,omitempty"`
+	}
+	openAPIMediaType struct {
+		Schema  *openAPISchema `json:"schema,omitempty" yaml:"schema,omitempty"`
+		Example interface{}    `json:"example,omitempty" yaml:"example,omitempty"`
+	}
+	openAPISchema struct {
+		Type        string                    `json:"type,omitempty" yaml:"type,omitempty"`
+		Format      string                    `json:"format,omitempty" yaml:"format,omitempty"`
+		Description string                    `json:"description,omitempty" yaml:"description,omitempty"`
+		Items       *openAPISchema            `json:"items,omitempty" yaml:"items,omitempty"`
+		Properties  map[string]*openAPISchema `json:"properties,omitempty" yaml:"properties,omitempty"`
+		Required    []string                  `json:"required,omitempty" yaml:"required,omitempty"`
+		MinLength   *int                      `json:"minLength,omitempty" yaml:"minLength,omitempty"`
+		MaxLength   *int                      `json:"maxLength,omitempty" yaml:"maxLength,omitempty"`
+		MinItems    *int                      `json:"minItems,omitempty" yaml:"minItems,omitempty"`
+		MaxItems    *int                      `json:"maxItems,omitempty" yaml:"maxItems,omitempty"`
+		Minimum     *float64                  `json:"minimum,omitempty" yaml:"minimum,omitempty"`
+		Maximum     *float64                  `json:"maximum,omitempty" yaml:"maximum,omitempty"`
+		Pattern     string                    `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	}
+)
+
+// OpenAPI returns the OpenAPI 3 document of all the frames.
+// The title is the frame names, and the version is the first frame version.
+// The operations of a path in several frames are merged, and it returns an
+// error if two handlers have the same method and path.
+func (m *Main) OpenAPI() (*OpenAPI, error) {
+	var names []string
+	var version string
+	for _, frame := range m.frames {
+		names = append(names, frame.name)
+		if version == "" {
+			version = frame.version
+		}
+	}
+	doc := newOpenAPI(strings.Join(names, ", "), version)
+	for _, frame := range m.frames {
+		if err := frame.router.addPaths(doc); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// OpenAPI returns the OpenAPI 3 document of the router.
+func (r *Router) OpenAPI(title, version string) (*OpenAPI, error) {
+	doc := newOpenAPI(title, version)
+	if err := r.addPaths(doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func newOpenAPI(title, version string) *OpenAPI {
+	if version == "" {
+		version = "1.0"
+	}
+	return &OpenAPI{
+		OpenAPI: "3.0.3",
+		Info:    openAPIInfo{Title: title, Version: version},
+		Paths:   make(map[string]map[string]*openAPIOperation),
+	}
+}
+
+// JSON returns the indented JSON document.
+func (doc *OpenAPI) JSON() ([]byte, error) {
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// YAML returns the YAML document.
+func (doc *OpenAPI) YAML() ([]byte, error) {
+	return yaml.Marshal(doc)
+}
+
+// addPaths adds the handlers of the router tree.
+func (r *Router) addPaths(doc *OpenAPI) error {
+	return r.root().addPaths(doc, "")
+}
+
+func (n *Node) addPaths(doc *OpenAPI, prefix string) error {
+	p := strings.TrimRight(prefix, "/") + "/" + n.pattern
+	if n.handler == nil {
+		for _, child := range n.children {
+			if err := child.addPaths(doc, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	p = openAPIPath(p)
+	var fields []Field
+	if h, ok := n.handler.(*StructHandler); ok {
+		fields = h.Fields
+		// faygo appends the path params of the struct to the pattern
+		for _, field := range fields {
+			if field.In == "path" {
+				p = strings.TrimRight(p, "/") + "/{" + field.paramName() + "}"
+			}
+		}
+	}
+	methodset := n.handler.GetMethod()
+	methods := methodset.Methods()
+	if len(methods) == 0 {
+		methods = []string{"GET"}
+	}
+	for _, method := range methods {
+		method = strings.ToLower(method)
+		if method == "connect" {
+			// OpenAPI has no CONNECT operation
+			continue
+		}
+		op := newOpenAPIOperation(n.handler, fields)
+		op.Parameters = append(implicitPathParams(p, fields), op.Parameters...)
+		if len(methods) > 1 {
+			op.OperationID += faygo.CamelString(method)
+		}
+		if doc.Paths[p] == nil {
+			doc.Paths[p] = make(map[string]*openAPIOperation)
+		}
+		if old := doc.Paths[p][method]; old != nil {
+			return errors.New("operation conflicts: " + strings.ToUpper(method) + " " + p + " of " + old.OperationID + " and " + op.OperationID)
+		}
+		doc.Paths[p][method] = op
+	}
+	return nil
+}
+
+// implicitPathParams returns the required string parameters of the path
+// template, e.g. `{id}` of `/pets/{id}`, which are not declared by the fields.
+func implicitPathParams(p string, fields []Field) []*openAPIParameter {
+	declared := make(map[string]bool)
+	for _, field := range fields {
+		if field.In == "path" {
+			declared[field.paramName()] = true
+		}
+	}
+	var params []*openAPIParameter
+	for _, s := range strings.Split(p, "/") {
+		if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+			continue
+		}
+		name := s[1 : len(s)-1]
+		if declared[name] {
+			continue
+		}
+		declared[name] = true
+		params = append(params, &openAPIParameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   &openAPISchema{Type: "string"},
+		})
+	}
+	return params
+}
+
+// openAPIPath returns the OpenAPI path, e.g. `/pets/{id}` for `/pets/:id`.
+func openAPIPath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func newOpenAPIOperation(handler Handler, fields []Field) *openAPIOperation {
+	var note, ret string
+	switch h := handler.(type) {
+	case *StructHandler:
+		note, ret = h.Note, h.Return
+	case *FuncHandler:
+		note, ret = h.Note, h.Return
+	}
+	op := &openAPIOperation{
+		OperationID: handler.GetName(),
+		Responses: map[string]*openAPIResponse{
+			"200": openAPIReturn(ret),
+		},
+	}
+	if note != "" {
+		op.Summary = strings.Split(note, "\n")[0]
+		if op.Summary != note {
+			op.Description = note
+		}
+	}
+	var form = &openAPISchema{Type: "object", Properties: make(map[string]*openAPISchema)}
+	var formType = "application/x-www-form-urlencoded"
+	for _, field := range fields {
+		schema := field.openAPISchema()
+		switch field.In {
+		case "path", "query", "header", "cookie":
+			op.Parameters = append(op.Parameters, &openAPIParameter{
+				Name:        field.paramName(),
+				In:          field.In,
+				Description: field.Desc,
+				// path params are always required
+				Required: field.Required || field.In == "path",
+				Schema:   schema,
+			})
+		case "formData":
+			schema.Description = field.Desc
+			form.Properties[field.paramName()] = schema
+			if field.Required {
+				form.Required = append(form.Required, field.paramName())
+			}
+			if schema.Format == "binary" || (schema.Items != nil && schema.Items.Format == "binary") {
+				formType = "multipart/form-data"
+			}
+		case "body":
+			schema.Description = field.Desc
+			op.RequestBody = &openAPIRequestBody{
+				Required: field.Required,
+				Content: map[string]*openAPIMediaType{
+					"application/json": {Schema: schema},
+				},
+			}
+		}
+	}
+	if len(form.Properties) > 0 {
+		op.RequestBody = &openAPIRequestBody{
+			Required: len(form.Required) > 0,
+			Content: map[string]*openAPIMediaType{
+				formType: {Schema: form},
+			},
+		}
+	}
+	return op
+}
+
+// openAPIReturn returns the response with the example of the response content demo.
+// The `//` comment lines are skipped, and the rest is a JSON or text example.
+func openAPIReturn(ret string) *openAPIResponse {
+	resp := &openAPIResponse{Description: "OK"}
+	var lines []string
+	for _, line := range strings.Split(ret, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "//") {
+			lines = append(lines, line)
+		}
+	}
+	example := strings.TrimSpace(strings.Join(lines, "\n"))
+	if example == "" {
+		return resp
+	}
+	var v interface{}
+	if json.Unmarshal([]byte(example), &v) == nil {
+		resp.Content = map[string]*openAPIMediaType{"application/json": {Example: v}}
+	} else {
+		resp.Content = map[string]*openAPIMediaType{"text/plain": {Example: example}}
+	}
+	return resp
+}
+
+// paramName returns the request param name.
+func (f *Field) paramName() string {
+	if f.ParamName != "" {
+		return f.ParamName
+	}
+	return faygo.SnakeString(f.Name)
+}
+
+// openAPISchema returns the schema of the field's type and validation.
+func (f *Field) openAPISchema() *openAPISchema {
+	schema := goTypeSchema(f.Type)
+	if f.Len != "" {
+		min, max := splitTuple(f.Len)
+		if schema.Type == "array" {
+			schema.MinItems, schema.MaxItems = intOrNil(min), intOrNil(max)
+		} else {
+			schema.MinLength, schema.MaxLength = intOrNil(min), intOrNil(max)
+		}
+	}
+	if f.Range != "" {
+		min, max := splitTuple(f.Range)
+		schema.Minimum, schema.Maximum = floatOrNil(min), floatOrNil(max)
+	}
+	schema.Pattern = f.Regexp
+	return schema
+}
+
+// goTypeSchema returns the schema of the param value type.
+func goTypeSchema(typ string) *openAPISchema {
+	switch typ {
+	case "string", "*http.Cookie", "http.Cookie":
+		return &openAPISchema{Type: "string"}
+	case "[]byte", "[]uint8":
+		return &openAPISchema{Type: "string", Format: "binary"}
+	case "bool":
+		return &openAPISchema{Type: "boolean"}
+	case "int", "int8", "int16", "int32", "uint", "uint8", "uint16", "uint32", "byte":
+		return &openAPISchema{Type: "integer", Format: "int32"}
+	case "int64", "uint64":
+		return &openAPISchema{Type: "integer", Format: "int64"}
+	case "float32":
+		return &openAPISchema{Type: "number", Format: "float"}
+	case "float64":
+		return &openAPISchema{Type: "number", Format: "double"}
+	case "*multipart.FileHeader", "multipart.FileHeader":
+		return &openAPISchema{Type: "string", Format: "binary"}
+	}
+	if strings.HasPrefix(typ, "[]") {
+		return &openAPISchema{Type: "array", Items: goTypeSchema(typ[2:])}
+	}
+	// struct types, only for body params
+	return &openAPISchema{Type: "object"}
+}
+
+// splitTuple splits `min:max`, `n` is `n:n`.
+func splitTuple(tuple string) (min, max string) {
+	a := strings.SplitN(tuple, ":", 2)
+	if len(a) == 1 {
+		return a[0], a[0]
+	}
+	return a[0], a[1]
+}
+
+func intOrNil(s string) *int {
+	i, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return nil
+	}
+	return &i
+}
+
+func floatOrNil(s string) *float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
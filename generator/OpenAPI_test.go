@@ -0,0 +1,227 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestOpenAPI(t *testing.T) {
+	root := tempModule(t)
+	defer os.RemoveAll(root)
+	spec, err := ParseSpec([]byte(`
+frames:
+  - name: myapp
+    version: "1.2"
+    router:
+      func: Route
+      dir: router
+      handlers:
+        - {name: Index, type: func, dir: handler, url: /, method: GET, note: home page}
+        - name: Pet
+          dir: handler
+          url: /v1/pets/:id
+          method: GET PUT
+          note: "pet\nshow or update a pet"
+          return: "// JSON\n{\"id\": 1}"
+          fields:
+            - {name: ID, param_name: id, type: int64, in: path}
+            - {name: Fields, type: "[]string", in: query, len: "1:5"}
+            - {name: Name, in: formData, required: true, len: "1:10", regexp: "^\\w+$"}
+            - {name: Age, type: uint8, in: formData, range: "1:100"}
+            - {name: Avatar, type: "*multipart.FileHeader", in: formData}
+`), ".yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := spec.Main(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := m.OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Info.Title != "myapp" || doc.Info.Version != "1.2" {
+		t.Errorf("unexpected info %+v", doc.Info)
+	}
+	if len(doc.Paths) != 2 {
+		t.Fatalf("got paths %v, want / and /v1/pets/{id}", doc.Paths)
+	}
+	index := doc.Paths["/"]["get"]
+	if index == nil || index.OperationID != "Index" || index.Summary != "home page" {
+		t.Errorf("unexpected GET / %+v", index)
+	}
+
+	pet := doc.Paths["/v1/pets/{id}"]
+	if pet["get"] == nil || pet["put"] == nil || pet["get"].OperationID != "PetGet" {
+		t.Fatalf("unexpected /v1/pets/{id} %+v", pet)
+	}
+	op := pet["put"]
+	if op.Summary != "pet" || op.Description != "pet\nshow or update a pet" {
+		t.Errorf("unexpected summary %q or description %q", op.Summary, op.Description)
+	}
+	one, five := 1, 5
+	wantParams := []*openAPIParameter{
+		{Name: "id", In: "path", Required: true, Schema: &openAPISchema{Type: "integer", Format: "int64"}},
+		{Name: "fields", In: "query", Schema: &openAPISchema{Type: "array", Items: &openAPISchema{Type: "string"}, MinItems: &one, MaxItems: &five}},
+	}
+	if !reflect.DeepEqual(op.Parameters, wantParams) {
+		t.Errorf("got params %s, want %s", jsonString(op.Parameters), jsonString(wantParams))
+	}
+	form := op.RequestBody.Content["multipart/form-data"]
+	if form == nil || !reflect.DeepEqual(form.Schema.Required, []string{"name"}) {
+		t.Fatalf("unexpected request body %s", jsonString(op.RequestBody))
+	}
+	if name := form.Schema.Properties["name"]; name.Pattern != `^\w+$` || *name.MaxLength != 10 {
+		t.Errorf("unexpected name schema %s", jsonString(name))
+	}
+	if age := form.Schema.Properties["age"]; age.Type != "integer" || *age.Maximum != 100 {
+		t.Errorf("unexpected age schema %s", jsonString(age))
+	}
+	if avatar := form.Schema.Properties["avatar"]; avatar.Format != "binary" {
+		t.Errorf("unexpected avatar schema %s", jsonString(avatar))
+	}
+	example := op.Responses["200"].Content["application/json"].Example
+	if !reflect.DeepEqual(example, map[string]interface{}{"id": 1.0}) {
+		t.Errorf("unexpected example %#v", example)
+	}
+
+	b, err := doc.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromJSON map[string]interface{}
+	if err = json.Unmarshal(b, &fromJSON); err != nil || fromJSON["openapi"] != "3.0.3" {
+		t.Errorf("invalid JSON document %v:\n%s", err, b)
+	}
+	b, err = doc.YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromYAML = new(OpenAPI)
+	if err = yaml.Unmarshal(b, fromYAML); err != nil || len(fromYAML.Paths["/v1/pets/{id}"]) != 2 {
+		t.Errorf("invalid YAML document %v:\n%s", err, b)
+	}
+
+	// the router tree can be walked again for the code
+	if err = m.Output(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(root, "handler", "pet.go")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOpenAPIPathParams(t *testing.T) {
+	root := tempModule(t)
+	defer os.RemoveAll(root)
+	const frames = `
+frames:
+  - name: myapp
+    router:
+      func: Route
+      dir: router
+      handlers:
+        - {name: Pet, dir: handler, url: /pets/:id, method: GET}
+        - {name: Photo, type: func, dir: handler, url: /pets/:id/photo, method: GET}
+        - {name: Static, type: func, dir: handler, url: /static/*filepath, method: GET}
+        - name: Owner
+          dir: handler
+          url: /pets/:id/owners
+          method: GET
+          fields:
+            - {name: Owner, param_name: owner, in: path}
+  - name: admin
+    router:
+      func: Route
+      dir: admin/router
+      handlers:
+        - name: AdminPet
+          dir: admin/handler
+          url: /pets/:id
+          method: %s
+          fields:
+            - {name: Force, type: bool, in: query}
+`
+	id := &openAPIParameter{Name: "id", In: "path", Required: true, Schema: &openAPISchema{Type: "string"}}
+	var cases = []struct {
+		path   string
+		method string
+		want   []*openAPIParameter
+	}{
+		{"/pets/{id}", "get", []*openAPIParameter{id}},
+		{"/pets/{id}/photo", "get", []*openAPIParameter{id}},
+		{"/static/{filepath}", "get", []*openAPIParameter{
+			{Name: "filepath", In: "path", Required: true, Schema: &openAPISchema{Type: "string"}},
+		}},
+		{"/pets/{id}/owners/{owner}", "get", []*openAPIParameter{
+			id,
+			{Name: "owner", In: "path", Required: true, Schema: &openAPISchema{Type: "string"}},
+		}},
+		// the operations of the other frame are merged
+		{"/pets/{id}", "delete", []*openAPIParameter{
+			id,
+			{Name: "force", In: "query", Schema: &openAPISchema{Type: "boolean"}},
+		}},
+	}
+	spec, err := ParseSpec([]byte(fmt.Sprintf(frames, "DELETE")), ".yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := spec.Main(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := m.OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		op := doc.Paths[c.path][c.method]
+		if op == nil {
+			t.Errorf("no %s %s in %s", c.method, c.path, jsonString(doc.Paths))
+			continue
+		}
+		if !reflect.DeepEqual(op.Parameters, c.want) {
+			t.Errorf("%s %s: got params %s, want %s", c.method, c.path, jsonString(op.Parameters), jsonString(c.want))
+		}
+	}
+
+	// the same operation in two frames is an error
+	spec, err = ParseSpec([]byte(fmt.Sprintf(frames, "GET")), ".yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, err = spec.Main(root); err != nil {
+		t.Fatal(err)
+	}
+	want := "operation conflicts: GET /pets/{id} of Pet and AdminPet"
+	if _, err = m.OpenAPI(); err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+}
+
+func jsonString(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
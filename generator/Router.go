@@ -24,11 +24,12 @@ import (
 
 // Router returns project router codes
 type Router struct {
-	funcname  string
-	dir       string // file path or package name
-	nodes     []*Node
-	isMainPkg bool
-	importmap map[string]bool
+	funcname    string
+	dir         string // file path or package name
+	nodes       []*Node
+	middlewares []Handler // they apply to the routes of their url path
+	isMainPkg   bool
+	importmap   map[string]bool
 }
 
 // NewRouter creates a *Router
@@ -58,7 +59,8 @@ func (r *Router) init() error {
 	return nil
 }
 
-// AddHandler adds handler.
+// AddHandler adds handler. Several handlers may have the same url path
+// with disjoint methods, e.g. `GET /pets` and `POST /pets`.
 func (r *Router) AddHandler(handler Handler) error {
 	if handler == nil {
 		return errors.New("The Handler param can not be nil.")
@@ -69,16 +71,11 @@ func (r *Router) AddHandler(handler Handler) error {
 		return err
 	}
 	for _, node := range r.nodes {
-		if node.urlPath == handler.GetUrlPath() {
-			if node.handler != nil || node.static != nil {
-				return errors.New("urlPath conflicts: " + _urlPath)
-			}
-			pkg := handler.PkgPath()
-			if pkg != r.PkgPath() {
-				r.importmap[pkg] = true
-			}
-			node.handler = handler
-			return nil
+		if node.urlPath != handler.GetUrlPath() {
+			continue
+		}
+		if node.static != nil || methodsOverlap(node.handler.GetMethod(), handler.GetMethod()) {
+			return errors.New("urlPath conflicts: " + _urlPath)
 		}
 	}
 	node := &Node{
@@ -86,20 +83,37 @@ func (r *Router) AddHandler(handler Handler) error {
 		handler: handler,
 		urlPath: handler.GetUrlPath(),
 	}
-	pkg := handler.PkgPath()
-	if pkg != r.PkgPath() {
-		r.importmap[pkg] = true
+	err = r.importHandler(handler)
+	if err != nil {
+		return err
 	}
 	r.nodes = append(r.nodes, node)
 	return nil
 }
 
-// AddMiddleware adds midddlerwares.
+// methodsOverlap returns whether the methodsets share a method,
+// an empty one may be any method.
+func methodsOverlap(a, b faygo.Methodset) bool {
+	ma, mb := a.Methods(), b.Methods()
+	if len(ma) == 0 || len(mb) == 0 {
+		return true
+	}
+	for _, m := range ma {
+		for _, n := range mb {
+			if m == n {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AddMiddleware adds midddlerwares. A middleware applies to the handlers and
+// the static of its url path, whenever they are added, else to the group of its path.
 func (r *Router) AddMiddleware(handlers ...Handler) error {
 	if len(handlers) == 0 {
 		return nil
 	}
-loop:
 	for _, handler := range handlers {
 		if handler == nil {
 			return errors.New("The middleware Handler param can not be nil.")
@@ -108,22 +122,27 @@ loop:
 		if err != nil {
 			return err
 		}
-		pkg := handler.PkgPath()
-		if pkg != r.PkgPath() {
-			r.importmap[pkg] = true
-		}
-		for _, node := range r.nodes {
-			if node.urlPath == handler.GetUrlPath() {
-				node.middlewares = append(node.middlewares, handler)
-				continue loop
-			}
-		}
-		node := &Node{
-			Router:      r,
-			urlPath:     handler.GetUrlPath(),
-			middlewares: []Handler{handler},
+		err = r.importHandler(handler)
+		if err != nil {
+			return err
 		}
-		r.nodes = append(r.nodes, node)
+		r.middlewares = append(r.middlewares, handler)
+	}
+	return nil
+}
+
+// importHandler imports the handler's package if it is not the router's.
+func (r *Router) importHandler(handler Handler) error {
+	pkg, err := handler.PkgPath()
+	if err != nil {
+		return err
+	}
+	routerPkg, err := r.PkgPath()
+	if err != nil {
+		return err
+	}
+	if pkg != routerPkg {
+		r.importmap[pkg] = true
 	}
 	return nil
 }
@@ -151,11 +170,7 @@ func (r *Router) AddStatic(name, urlPath string, root string, nocompressAndNocac
 	}
 	for _, node := range r.nodes {
 		if node.urlPath == urlPath {
-			if node.handler != nil || node.static != nil {
-				return errors.New("urlPath conflicts: " + _urlPath)
-			}
-			node.static = static
-			return nil
+			return errors.New("urlPath conflicts: " + _urlPath)
 		}
 	}
 	node := &Node{
@@ -169,26 +184,36 @@ func (r *Router) AddStatic(name, urlPath string, root string, nocompressAndNocac
 
 // Output returns router's file.
 func (r *Router) Output() error {
-	code := r.Create()
-	err := writeFile(r.dir, faygo.SnakeString(r.funcname)+".go", code)
+	files, err := r.DryRun()
 	if err != nil {
 		return err
 	}
+	return writeFiles(files)
+}
+
+// DryRun returns router's file and the files of the handlers and middlewares
+// without writing them.
+func (r *Router) DryRun() ([]*File, error) {
+	code := r.Create()
+	f, err := newFile(r.dir, faygo.SnakeString(r.funcname)+".go", code)
+	if err != nil {
+		return nil, err
+	}
+	var files = []*File{f}
+	var handlers []Handler
 	for _, node := range r.nodes {
 		if node.handler != nil {
-			err = node.handler.Output()
-			if err != nil {
-				return err
-			}
+			handlers = append(handlers, node.handler)
 		}
-		for _, ware := range node.middlewares {
-			err = ware.Output()
-			if err != nil {
-				return err
-			}
+	}
+	for _, handler := range append(handlers, r.middlewares...) {
+		f, err = handler.DryRun()
+		if err != nil {
+			return nil, err
 		}
+		files = append(files, f)
 	}
-	return nil
+	return uniqueFiles(files), nil
 }
 
 // Create returns router's codes.
@@ -198,15 +223,11 @@ func (r *Router) Create() string {
 }
 
 // PkgPath returns the package path, e.g `github.com/henrylee2cn/fay/test`
-func (r *Router) PkgPath() string {
+func (r *Router) PkgPath() (string, error) {
 	if r.isMainPkg || r.dir == "" {
-		return ""
-	}
-	dirs := strings.Split(r.dir, "/src/")
-	if len(dirs) < 2 {
-		faygo.Fatalf("You must generate codes in the `src` or its offspring directory!")
+		return "", nil
 	}
-	return strings.Join(dirs[1:], "/src/")
+	return ImportPath(r.dir)
 }
 
 // TryMainPkg tries to set it as the main package
@@ -238,53 +259,118 @@ func (r *Router) PkgPrefix() string {
 	return r.dir[strings.LastIndex(r.dir, "/")+1:] + "."
 }
 
+// root builds the router tree:
+//   - a handler or a static is a leaf at its url path, and the handlers of
+//     the same path, with disjoint methods, are sibling leaves;
+//   - a group holds the routes under its path, a leaf is never a group,
+//     e.g. `/pets` and `/pets/:id` are a leaf and a group with a leaf;
+//   - a middleware applies to the leaves of its url path, else to the leaves
+//     at its path in the tree, e.g. a struct handler of `/pets/:id` with an
+//     id path field for `/pets`, else to the group of its path, which is empty
+//     if there is no route under it, or to the routes of the root for the root path.
 func (r *Router) root() *Node {
 	var root = &Node{
 		Router: r,
 	}
+	groups := map[string]*Node{"": root}
+	// group returns the group of the path, creating the missing ones
+	var group func(p string) *Node
+	group = func(p string) *Node {
+		if g := groups[p]; g != nil {
+			return g
+		}
+		parent, pattern := root, p
+		if i := strings.LastIndex(p, "/"); i >= 0 {
+			parent, pattern = group(p[:i]), p[i+1:]
+		}
+		g := &Node{
+			Router:  r,
+			pattern: pattern,
+		}
+		parent.children = append(parent.children, g)
+		groups[p] = g
+		return g
+	}
+	var leaves []*Node
+	var leafPaths = make(map[*Node]string)
 	for _, node := range r.nodes {
 		var p string
 		if node.handler != nil {
-			p = strings.Split(node.handler.GetUrlPath(), "/:")[0]
-		} else if node.static != nil {
-			p = strings.Split(node.static.UrlPath, "/:")[0]
-		} else if len(node.middlewares) > 0 {
-			p = strings.Split(node.middlewares[0].GetUrlPath(), "/:")[0]
+			p = routePath(node.handler)
+		} else {
+			p = trimParams(node.static.UrlPath)
 		}
-		p = strings.Split(p, "/*")[0]
-		var ps = strings.Split(p, "/")
-		var curNode = root
-		var last = len(ps) - 1
-	loop:
-		for i, p := range ps {
-			node.pattern = p
-			if i == last {
-				for _, child := range curNode.children {
-					if child.pattern == p {
-						child.middlewares = append(child.middlewares, node.middlewares...)
-						break loop
-					}
-				}
-				curNode.children = append(curNode.children, node)
-				break
-			}
-			for _, child := range curNode.children {
-				if child.pattern == p {
-					curNode = child
-					continue loop
-				}
+		leaf := &Node{
+			Router:  r,
+			urlPath: node.urlPath,
+			handler: node.handler,
+			static:  node.static,
+		}
+		parent, pattern := root, p
+		if i := strings.LastIndex(p, "/"); i >= 0 {
+			parent, pattern = group(p[:i]), p[i+1:]
+		}
+		leaf.pattern = pattern
+		parent.children = append(parent.children, leaf)
+		leaves = append(leaves, leaf)
+		leafPaths[leaf] = p
+	}
+	// use adds the middleware to the leaves of the url path or of the tree path
+	use := func(ware Handler, match func(leaf *Node) bool) bool {
+		var found bool
+		for _, leaf := range leaves {
+			if match(leaf) {
+				leaf.middlewares = append(leaf.middlewares, ware)
+				found = true
 			}
-			group := &Node{
-				Router:  r,
-				pattern: p,
+		}
+		return found
+	}
+	for _, ware := range r.middlewares {
+		p := trimParams(ware.GetUrlPath())
+		if use(ware, func(leaf *Node) bool { return leaf.urlPath == ware.GetUrlPath() }) ||
+			use(ware, func(leaf *Node) bool { return leafPaths[leaf] == p }) {
+			continue
+		}
+		if p == "" {
+			// the root group has no code, so its children use it
+			for _, child := range root.children {
+				child.middlewares = append(child.middlewares, ware)
 			}
-			curNode.children = append(curNode.children, group)
-			curNode = group
+			continue
 		}
+		g := group(p)
+		g.middlewares = append(g.middlewares, ware)
 	}
 	return root
 }
 
+// routePath returns the path of the handler in the router tree. faygo appends
+// the path params of a struct handler to its pattern, so they are trimmed from
+// the end of the url path, e.g. `pets` for `pets/:id` with an `id` path field.
+func routePath(handler Handler) string {
+	p := handler.GetUrlPath()
+	h, ok := handler.(*StructHandler)
+	if !ok {
+		return p
+	}
+	var params string
+	for i := range h.Fields {
+		if h.Fields[i].In == "path" {
+			params += "/:" + h.Fields[i].paramName()
+		}
+	}
+	return strings.Trim(strings.TrimSuffix("/"+p, params), "/")
+}
+
+// trimParams trims the path params and the wildcard of the url path,
+// faygo appends the wildcard of a static.
+func trimParams(urlPath string) string {
+	p := strings.Split("/"+urlPath, "/:")[0]
+	p = strings.Split(p, "/*")[0]
+	return strings.Trim(p, "/")
+}
+
 type (
 	// Node router tree
 	Node struct {
@@ -299,9 +385,10 @@ type (
 	// Handler interface
 	Handler interface {
 		Output() error
+		DryRun() (*File, error)
 		TryMainPkg(mainPkgPath string)
 		GetUrlPath() string
-		PkgPath() string
+		PkgPath() (string, error)
 		PkgPrefix() string
 		RouterName() string
 		GetName() string
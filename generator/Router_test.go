@@ -1,6 +1,8 @@
 package generator
 
 import (
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -42,3 +44,139 @@ func TestRouter(t *testing.T) {
 	router.AddHandler(structure)
 	t.Log(router.Output())
 }
+
+func TestRouterTree(t *testing.T) {
+	root := tempModule(t)
+	defer os.RemoveAll(root)
+	var router, err = NewRouter("Route", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, handler := range []Handler{
+		&StructHandler{Dir: root, Name: "List", UrlPath: "/pets", Method: "GET"},
+		&StructHandler{Dir: root, Name: "Create", UrlPath: "/pets", Method: "POST"},
+		&StructHandler{Dir: root, Name: "Show", UrlPath: "/pets/:id", Method: "GET"},
+		// faygo appends the path params of the struct
+		&StructHandler{Dir: root, Name: "Remove", UrlPath: "/pets/:id", Method: "DELETE",
+			Fields: []Field{{Type: "int", Name: "Id", In: "path"}}},
+		&FuncHandler{Dir: root, Name: "Toys", UrlPath: "/pets/toys/*path", Method: "GET"},
+	} {
+		if err = router.AddHandler(handler); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = router.AddHandler(&StructHandler{Dir: root, Name: "Replace", UrlPath: "/pets", Method: "GET PUT"})
+	if err == nil || !strings.Contains(err.Error(), "urlPath conflicts") {
+		t.Errorf("got error %v, want a conflict of the GET methods", err)
+	}
+	err = router.AddMiddleware(
+		&FuncHandler{Dir: root, Name: "Auth", UrlPath: "/pets"},
+		&FuncHandler{Dir: root, Name: "Admin", UrlPath: "/admin"},
+		&FuncHandler{Dir: root, Name: "Log", UrlPath: "/"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := router.Create()
+	want := `frame.Route(
+frame.NewNamedAPI("List", "GET", "/pets", &List{}).Use(Auth, Log),
+frame.NewNamedAPI("Create", "POST", "/pets", &Create{}).Use(Auth, Log),
+frame.NewGroup("/pets",
+frame.NewNamedAPI("Show", "GET", "/:id", &Show{}),
+frame.NewGroup("/toys",
+frame.NewNamedAPI("Toys", "GET", "/*path", Toys),
+),
+).Use(Log),
+frame.NewNamedAPI("Remove", "DELETE", "/pets", &Remove{}).Use(Log),
+frame.NewGroup("/admin",
+).Use(Admin, Log),
+)`
+	if !strings.Contains(code, want) {
+		t.Errorf("got router\n%s\nwant\n%s", code, want)
+	}
+}
+
+func TestRouterMiddlewares(t *testing.T) {
+	root := tempModule(t)
+	defer os.RemoveAll(root)
+	handler := func(name, urlPath string) func(r *Router) error {
+		return func(r *Router) error {
+			return r.AddHandler(&FuncHandler{Dir: root, Name: name, UrlPath: urlPath, Method: "GET"})
+		}
+	}
+	middleware := func(name, urlPath string) func(r *Router) error {
+		return func(r *Router) error {
+			return r.AddMiddleware(&FuncHandler{Dir: root, Name: name, UrlPath: urlPath})
+		}
+	}
+	static := func(r *Router) error {
+		return r.AddStatic("Static", "/static", "./static")
+	}
+	var cases = []struct {
+		name  string
+		calls []func(r *Router) error
+		want  string
+	}{
+		{"after the handler", []func(*Router) error{handler("List", "/pets"), middleware("Auth", "/pets")},
+			`frame.NewNamedAPI("List", "GET", "/pets", List).Use(Auth),
+)`},
+		{"before the handler", []func(*Router) error{middleware("Auth", "/pets"), handler("List", "/pets")},
+			`frame.NewNamedAPI("List", "GET", "/pets", List).Use(Auth),
+)`},
+		{"after the static", []func(*Router) error{static, middleware("Auth", "/static")},
+			`frame.NewNamedStatic("Static", "/static", "./static", false, false).Use(Auth),
+)`},
+		{"before the static", []func(*Router) error{middleware("Auth", "/static"), static},
+			`frame.NewNamedStatic("Static", "/static", "./static", false, false).Use(Auth),
+)`},
+		// only the handler of the same url path
+		{"path params", []func(*Router) error{handler("List", "/pets"), handler("Show", "/pets/:id"), middleware("Auth", "/pets/:id")},
+			`frame.NewNamedAPI("List", "GET", "/pets", List),
+frame.NewGroup("/pets",
+frame.NewNamedAPI("Show", "GET", "/:id", Show).Use(Auth),
+),
+)`},
+		{"root handler", []func(*Router) error{handler("Index", "/"), handler("List", "/pets"), middleware("Token", "/")},
+			`frame.NewNamedAPI("Index", "GET", "/", Index).Use(Token),
+frame.NewNamedAPI("List", "GET", "/pets", List),
+)`},
+		// faygo appends the path params of the struct, so it is at /pets in the tree
+		{"struct path params", []func(*Router) error{
+			func(r *Router) error {
+				return r.AddHandler(&StructHandler{Dir: root, Name: "Show", UrlPath: "/pets/:id", Method: "GET",
+					Fields: []Field{{Type: "int", Name: "Id", In: "path"}}})
+			},
+			middleware("Auth", "/pets"),
+		}, `frame.NewNamedAPI("Show", "GET", "/pets", &Show{}).Use(Auth),
+)`},
+		// without a route of the path, the group of the path
+		{"group", []func(*Router) error{handler("Toys", "/pets/toys"), middleware("Auth", "/pets")},
+			`frame.NewGroup("/pets",
+frame.NewNamedAPI("Toys", "GET", "/toys", Toys),
+).Use(Auth),
+)`},
+		{"no route", []func(*Router) error{handler("List", "/pets"), middleware("Auth", "/admin")},
+			`frame.NewNamedAPI("List", "GET", "/pets", List),
+frame.NewGroup("/admin",
+).Use(Auth),
+)`},
+		{"root", []func(*Router) error{handler("List", "/pets"), middleware("Token", "/")},
+			`frame.NewNamedAPI("List", "GET", "/pets", List).Use(Token),
+)`},
+	}
+	for _, c := range cases {
+		router, err := NewRouter("Route", root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, call := range c.calls {
+			if err = call(router); err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+		}
+		code := router.Create()
+		if !strings.Contains(code, "frame.Route(\n"+c.want) {
+			t.Errorf("%s: got router\n%s\nwant\n%s", c.name, code, c.want)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/henrylee2cn/faygo"
+)
+
+// Route a route declared in the router tree
+type Route struct {
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	Name        string   `json:"name,omitempty"`
+	Handler     string   `json:"handler"`
+	Middlewares []string `json:"middlewares"`
+	File        string   `json:"file"`
+	Line        int      `json:"line"`
+}
+
+// routeParser parses the router trees of the go files in a dir
+type routeParser struct {
+	dir   string
+	fset  *token.FileSet
+	files []*ast.File
+	// import path of the package of each file
+	pkgPaths map[*ast.File]string
+	// package name of each import path
+	pkgNames map[string]string
+	// path params of the struct handlers, by import path and type name
+	pathParams map[string]map[string][]string
+	routes     []*Route
+}
+
+// ParseRoutes parses the go files in dir and its subdirs, and returns the
+// routes of the tree style router, i.e. the `frame.Route(...)` calls with
+// NewGroup, NewNamedGroup, NewAPI, NewNamedAPI, NewStatic, NewNamedStatic and Use.
+// The path params of the struct handlers are appended like faygo does.
+func ParseRoutes(dir string) ([]*Route, error) {
+	p := &routeParser{
+		dir:        dir,
+		fset:       token.NewFileSet(),
+		pkgPaths:   make(map[*ast.File]string),
+		pkgNames:   make(map[string]string),
+		pathParams: make(map[string]map[string][]string),
+	}
+	dirPaths := make(map[string]string)
+	err := filepath.Walk(dir, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		base := fi.Name()
+		if fi.IsDir() {
+			if name != dir && (base == "vendor" || base == "testdata" || strings.HasPrefix(base, ".") || strings.HasPrefix(base, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(base, ".go") || strings.HasSuffix(base, "_test.go") {
+			return nil
+		}
+		f, err := parser.ParseFile(p.fset, name, nil, 0)
+		if err != nil {
+			return err
+		}
+		pkgDir := filepath.Dir(name)
+		pkgPath, ok := dirPaths[pkgDir]
+		if !ok {
+			pkgPath, err = ImportPath(pkgDir)
+			if err != nil {
+				// outside a module and GOPATH, the dir still tells the packages apart
+				pkgPath = filepath.ToSlash(pkgDir)
+			}
+			dirPaths[pkgDir] = pkgPath
+		}
+		p.files = append(p.files, f)
+		p.pkgPaths[f] = pkgPath
+		p.pkgNames[pkgPath] = f.Name.Name
+		p.collectPathParams(f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range p.files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || callName(call) != "Route" {
+				return true
+			}
+			for _, arg := range call.Args {
+				p.node(f, arg, "", nil)
+			}
+			return false
+		})
+	}
+	return p.routes, nil
+}
+
+var paramTagRegexp = regexp.MustCompile(`<\s*(in|name)\s*:\s*([^>]*)>`)
+
+// collectPathParams records the `in:path` fields of the struct types.
+func (p *routeParser) collectPathParams(f *ast.File) {
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			var params []string
+			for _, field := range st.Fields.List {
+				if field.Tag == nil || len(field.Names) == 0 {
+					continue
+				}
+				tag, err := strconv.Unquote(field.Tag.Value)
+				if err != nil {
+					continue
+				}
+				var in, name string
+				for _, m := range paramTagRegexp.FindAllStringSubmatch(reflect.StructTag(tag).Get("param"), -1) {
+					if m[1] == "in" {
+						in = strings.TrimSpace(m[2])
+					} else {
+						name = strings.TrimSpace(m[2])
+					}
+				}
+				if in != "path" {
+					continue
+				}
+				if name == "" {
+					name = faygo.SnakeString(field.Names[0].Name)
+				}
+				params = append(params, name)
+			}
+			pkgPath := p.pkgPaths[f]
+			if p.pathParams[pkgPath] == nil {
+				p.pathParams[pkgPath] = make(map[string][]string)
+			}
+			p.pathParams[pkgPath][ts.Name.Name] = params
+		}
+	}
+}
+
+// node parses a router node with its middlewares, e.g. `frame.NewGroup(...).Use(...)`.
+func (p *routeParser) node(f *ast.File, expr ast.Expr, prefix string, middlewares []string) {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return
+	}
+	// the outer Use is the last one, so it runs after the inner ones
+	var uses [][]string
+	for callName(call) == "Use" {
+		var wares []string
+		for _, arg := range call.Args {
+			wares = append(wares, p.source(arg))
+		}
+		uses = append([][]string{wares}, uses...)
+		inner, ok := call.Fun.(*ast.SelectorExpr).X.(*ast.CallExpr)
+		if !ok {
+			return
+		}
+		call = inner
+	}
+	middlewares = append([]string{}, middlewares...)
+	for _, wares := range uses {
+		middlewares = append(middlewares, wares...)
+	}
+
+	args := call.Args
+	switch name := callName(call); name {
+	case "NewGroup", "NewNamedGroup":
+		if name == "NewNamedGroup" && len(args) > 0 {
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			return
+		}
+		groupPrefix := joinRoutePath(prefix, p.stringArg(args[0]))
+		for _, child := range args[1:] {
+			p.node(f, child, groupPrefix, middlewares)
+		}
+	case "NewAPI", "NewNamedAPI":
+		var routeName string
+		if name == "NewNamedAPI" {
+			if len(args) == 0 {
+				return
+			}
+			routeName, args = p.stringArg(args[0]), args[1:]
+		}
+		if len(args) < 3 {
+			return
+		}
+		methodset := faygo.Methodset(p.stringArg(args[0]))
+		routePath := joinRoutePath(prefix, p.stringArg(args[1]))
+		for _, param := range p.handlerPathParams(f, args[2]) {
+			routePath = joinRoutePath(routePath, "/:"+param)
+		}
+		for _, method := range methodset.Methods() {
+			p.add(call, &Route{
+				Method:      method,
+				Path:        routePath,
+				Name:        routeName,
+				Handler:     handlerSource(p.source(args[2])),
+				Middlewares: middlewares,
+			})
+		}
+	case "NewStatic", "NewNamedStatic":
+		var routeName string
+		if name == "NewNamedStatic" {
+			if len(args) == 0 {
+				return
+			}
+			routeName, args = p.stringArg(args[0]), args[1:]
+		}
+		if len(args) < 2 {
+			return
+		}
+		p.add(call, &Route{
+			Method:      "GET",
+			Path:        joinRoutePath(joinRoutePath(prefix, p.stringArg(args[0])), "/*filepath"),
+			Name:        routeName,
+			Handler:     "static " + p.stringArg(args[1]),
+			Middlewares: middlewares,
+		})
+	}
+}
+
+func (p *routeParser) add(call *ast.CallExpr, route *Route) {
+	pos := p.fset.Position(call.Pos())
+	route.File = pos.Filename
+	if rel, err := filepath.Rel(p.dir, pos.Filename); err == nil {
+		route.File = filepath.ToSlash(rel)
+	}
+	route.Line = pos.Line
+	if route.Middlewares == nil {
+		route.Middlewares = []string{}
+	}
+	p.routes = append(p.routes, route)
+}
+
+// handlerPathParams returns the path params of a struct handler, e.g. `&handler.Login{}`.
+func (p *routeParser) handlerPathParams(f *ast.File, expr ast.Expr) []string {
+	if u, ok := expr.(*ast.UnaryExpr); ok && u.Op == token.AND {
+		expr = u.X
+	}
+	if call, ok := expr.(*ast.CallExpr); ok && len(call.Args) == 1 {
+		if ident, ok := call.Fun.(*ast.Ident); ok && ident.Name == "new" {
+			expr = call.Args[0]
+		}
+	}
+	if lit, ok := expr.(*ast.CompositeLit); ok {
+		expr = lit.Type
+	}
+	switch x := expr.(type) {
+	case *ast.Ident:
+		return p.pathParams[p.pkgPaths[f]][x.Name]
+	case *ast.SelectorExpr:
+		if pkg, ok := x.X.(*ast.Ident); ok {
+			return p.pathParams[p.importedPkgPath(f, pkg.Name)][x.Sel.Name]
+		}
+	}
+	return nil
+}
+
+// importedPkgPath returns the import path of the import name, the name of an
+// unnamed import is the package name of a parsed package, or is assumed to be
+// the last element of the import path.
+func (p *routeParser) importedPkgPath(f *ast.File, name string) string {
+	for _, imp := range f.Imports {
+		importPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		if imp.Name != nil {
+			if imp.Name.Name == name {
+				return importPath
+			}
+			continue
+		}
+		if pkgName, ok := p.pkgNames[importPath]; ok {
+			if pkgName == name {
+				return importPath
+			}
+		} else if path.Base(importPath) == name {
+			return importPath
+		}
+	}
+	return ""
+}
+
+// stringArg returns the string literal, or the source of other expressions.
+func (p *routeParser) stringArg(expr ast.Expr) string {
+	if lit, ok := expr.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+		if s, err := strconv.Unquote(lit.Value); err == nil {
+			return s
+		}
+	}
+	return "{" + p.source(expr) + "}"
+}
+
+func (p *routeParser) source(expr ast.Expr) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, p.fset, expr)
+	return buf.String()
+}
+
+// callName returns the name of the called method, e.g. `NewGroup` for `frame.NewGroup(...)`.
+func callName(call *ast.CallExpr) string {
+	if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+		return sel.Sel.Name
+	}
+	return ""
+}
+
+// handlerSource returns the handler without the `&` and `{}` of a struct literal.
+func handlerSource(s string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(s, "&"), "{}")
+}
+
+func joinRoutePath(prefix, p string) string {
+	return "/" + strings.Trim(strings.TrimRight(prefix, "/")+"/"+strings.TrimLeft(p, "/"), "/")
+}
@@ -0,0 +1,115 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseRoutes(t *testing.T) {
+	root := tempModule(t)
+	defer os.RemoveAll(root)
+	spec, err := ParseSpec([]byte(`
+frames:
+  - name: myapp
+    router:
+      func: Route
+      dir: router
+      handlers:
+        - {name: Index, type: func, dir: handler, url: /, method: GET}
+        - name: Pet
+          dir: handler
+          url: /v1/pets/:id
+          method: GET PUT
+          note: show or update a pet
+          fields:
+            - {name: ID, param_name: id, type: int64, in: path}
+            - {name: Name, in: query}
+      middlewares:
+        - {name: Auth, dir: middleware, url: /v1}
+        - {name: Log, dir: middleware, url: /v1/pets}
+      statics:
+        - {name: static fs, url: /static, root: ./static}
+`), ".yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := spec.Main(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Output(); err != nil {
+		t.Fatal(err)
+	}
+	// a router file that is not generated
+	err = ioutil.WriteFile(filepath.Join(root, "router", "admin.go"), []byte(`package router
+
+import (
+	ah "example.com/app/admin/handler"
+	h "example.com/app/handler"
+	"github.com/henrylee2cn/faygo"
+)
+
+func Admin(frame *faygo.Framework) {
+	frame.Route(
+		frame.NewNamedGroup("admin", "/admin",
+			frame.NewAPI("DELETE", "/pets", new(h.Pet)),
+			frame.NewAPI("GET", "/owners", &ah.Pet{}),
+		).Use(h.Index).Use(h.Index),
+	)
+}
+`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a struct handler of the same package name and type name in another package
+	err = os.MkdirAll(filepath.Join(root, "admin", "handler"), 0777)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(root, "admin", "handler", "pet.go"), []byte(`package handler
+
+type Pet struct {
+	Owner string `+"`param:\"<in:path>\"`"+`
+}
+`), 0666)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes, err := ParseRoutes(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Route{
+		{Method: "DELETE", Path: "/admin/pets/:id", Handler: "new(h.Pet)", Middlewares: []string{"h.Index", "h.Index"}, File: "router/admin.go", Line: 12},
+		{Method: "GET", Path: "/admin/owners/:owner", Handler: "ah.Pet", Middlewares: []string{"h.Index", "h.Index"}, File: "router/admin.go", Line: 13},
+		{Method: "GET", Path: "/", Name: "Index", Handler: "handler.Index", Middlewares: []string{}, File: "router/route.go", Line: 12},
+		{Method: "GET", Path: "/v1/pets/:id", Name: "show or update a pet", Handler: "handler.Pet", Middlewares: []string{"middleware.Auth", "middleware.Log"}, File: "router/route.go", Line: 14},
+		{Method: "PUT", Path: "/v1/pets/:id", Name: "show or update a pet", Handler: "handler.Pet", Middlewares: []string{"middleware.Auth", "middleware.Log"}, File: "router/route.go", Line: 14},
+		{Method: "GET", Path: "/static/*filepath", Name: "static fs", Handler: "static ./static", Middlewares: []string{}, File: "router/route.go", Line: 16},
+	}
+	if len(routes) != len(want) {
+		t.Fatalf("got %d routes, want %d: %s", len(routes), len(want), jsonString(routes))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(routes[i], want[i]) {
+			t.Errorf("route %d: got %s, want %s", i, jsonString(routes[i]), jsonString(want[i]))
+		}
+	}
+}
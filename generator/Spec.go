@@ -0,0 +1,303 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/henrylee2cn/faygo"
+	"gopkg.in/yaml.v2"
+)
+
+type (
+	// Spec describes a faygo project declaratively, e.g. in YAML:
+	//
+	//     dir: .
+	//     frames:
+	//       - name: myapp
+	//         version: "1.0"
+	//         router:
+	//           func: Route
+	//           dir: router
+	//           handlers:
+	//             - name: Index
+	//               type: func
+	//               dir: handler
+	//               url: /
+	//               method: GET
+	//             - name: Login
+	//               dir: handler
+	//               url: /login
+	//               method: POST
+	//               note: user login
+	//               return: "{}"
+	//               fields:
+	//                 - {name: Name, type: string, in: formData, required: true, len: "1:10"}
+	//                 - {name: Age, type: uint8, in: formData, range: "1:100"}
+	//           middlewares:
+	//             - {name: Token, dir: middleware, url: /login}
+	//           statics:
+	//             - {name: static fs, url: /static, root: ./static}
+	//
+	// `dir` is relative to the spec file, and the other dirs are relative to `dir`.
+	// A handler is in the router's dir by default. A handler is a struct handler,
+	// unless its type is `func`; a middleware is a func handler by default.
+	Spec struct {
+		Dir    string       `yaml:"dir" json:"dir"`       // project dir, the main package
+		Frames []*FrameSpec `yaml:"frames" json:"frames"` // faygo apps
+	}
+	// FrameSpec faygo app spec
+	FrameSpec struct {
+		Name    string      `yaml:"name" json:"name"` // (required) app name
+		Version string      `yaml:"version" json:"version"`
+		Router  *RouterSpec `yaml:"router" json:"router"` // (required)
+	}
+	// RouterSpec router spec
+	RouterSpec struct {
+		Func        string         `yaml:"func" json:"func"` // (required) router func name
+		Dir         string         `yaml:"dir" json:"dir"`
+		Handlers    []*HandlerSpec `yaml:"handlers" json:"handlers"`
+		Middlewares []*HandlerSpec `yaml:"middlewares" json:"middlewares"`
+		Statics     []*StaticSpec  `yaml:"statics" json:"statics"`
+	}
+	// HandlerSpec struct handler or func handler spec
+	HandlerSpec struct {
+		Type    string       `yaml:"type" json:"type"` // `struct` or `func`
+		Dir     string       `yaml:"dir" json:"dir"`
+		UrlPath string       `yaml:"url" json:"url"`
+		Name    string       `yaml:"name" json:"name"` // (required)
+		Method  string       `yaml:"method" json:"method"`
+		Note    string       `yaml:"note" json:"note"`
+		Return  string       `yaml:"return" json:"return"`
+		Serve   string       `yaml:"serve" json:"serve"`   // main logic
+		Fields  []*FieldSpec `yaml:"fields" json:"fields"` // only for struct handler
+	}
+	// FieldSpec struct handler's field spec
+	FieldSpec struct {
+		Type      string `yaml:"type" json:"type"` // `string` by default
+		Name      string `yaml:"name" json:"name"` // (required)
+		ParamName string `yaml:"param_name" json:"param_name"`
+		In        string `yaml:"in" json:"in"`
+		Required  bool   `yaml:"required" json:"required"`
+		Nonzero   bool   `yaml:"nonzero" json:"nonzero"`
+		Len       string `yaml:"len" json:"len"`
+		Range     string `yaml:"range" json:"range"`
+		Regexp    string `yaml:"regexp" json:"regexp"`
+		Maxmb     int    `yaml:"maxmb" json:"maxmb"`
+		Err       string `yaml:"err" json:"err"`
+		Desc      string `yaml:"desc" json:"desc"`
+		OtherTags string `yaml:"tags" json:"tags"`
+	}
+	// StaticSpec static router spec
+	StaticSpec struct {
+		Name       string `yaml:"name" json:"name"`
+		UrlPath    string `yaml:"url" json:"url"`
+		Root       string `yaml:"root" json:"root"` // served dir, relative to the working dir of the app
+		Nocompress bool   `yaml:"nocompress" json:"nocompress"`
+		Nocache    bool   `yaml:"nocache" json:"nocache"`
+	}
+)
+
+// LoadSpec reads the YAML or JSON spec file and creates the *Main.
+func LoadSpec(filename string) (*Main, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := ParseSpec(data, filepath.Ext(filename))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	filename, err = filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	m, err := spec.Main(filepath.Dir(filename))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return m, nil
+}
+
+// ParseSpec parses the spec, ext is the format, `.json` or `.yaml`.
+func ParseSpec(data []byte, ext string) (*Spec, error) {
+	var spec = new(Spec)
+	var err error
+	switch strings.ToLower(ext) {
+	case ".json":
+		// rejects the unknown keys like yaml.UnmarshalStrict
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(spec)
+		if err == nil && dec.More() {
+			err = fmt.Errorf("invalid data after the spec at offset %d", dec.InputOffset())
+		}
+	default:
+		err = yaml.UnmarshalStrict(data, spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// Main creates the *Main, the relative dirs are joined to baseDir.
+func (s *Spec) Main(baseDir string) (*Main, error) {
+	if len(s.Frames) == 0 {
+		return nil, fmt.Errorf("no frame")
+	}
+	dir := joinDir(baseDir, s.Dir)
+	m, err := NewMain(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i, frame := range s.Frames {
+		if frame == nil || frame.Router == nil {
+			return nil, fmt.Errorf("frames[%d]: the router must be setted", i)
+		}
+		router, err := frame.Router.Router(dir)
+		if err != nil {
+			return nil, fmt.Errorf("frames[%d].router: %v", i, err)
+		}
+		var version []string
+		if frame.Version != "" {
+			version = append(version, frame.Version)
+		}
+		err = m.AddFrame(router, frame.Name, version...)
+		if err != nil {
+			return nil, fmt.Errorf("frames[%d]: %v", i, err)
+		}
+	}
+	return m, nil
+}
+
+// Router creates the *Router, the relative dirs are joined to baseDir.
+func (r *RouterSpec) Router(baseDir string) (*Router, error) {
+	dir := joinDir(baseDir, r.Dir)
+	router, err := NewRouter(r.Func, dir)
+	if err != nil {
+		return nil, err
+	}
+	for i, h := range r.Handlers {
+		handler, err := h.handler(baseDir, dir, "struct")
+		if err != nil {
+			return nil, fmt.Errorf("handlers[%d]: %v", i, err)
+		}
+		err = router.AddHandler(handler)
+		if err != nil {
+			return nil, fmt.Errorf("handlers[%d]: %v", i, err)
+		}
+	}
+	for i, h := range r.Middlewares {
+		handler, err := h.handler(baseDir, dir, "func")
+		if err != nil {
+			return nil, fmt.Errorf("middlewares[%d]: %v", i, err)
+		}
+		err = router.AddMiddleware(handler)
+		if err != nil {
+			return nil, fmt.Errorf("middlewares[%d]: %v", i, err)
+		}
+	}
+	for i, s := range r.Statics {
+		if s == nil {
+			return nil, fmt.Errorf("statics[%d]: empty static", i)
+		}
+		err = router.AddStatic(s.Name, s.UrlPath, s.Root, s.Nocompress, s.Nocache)
+		if err != nil {
+			return nil, fmt.Errorf("statics[%d]: %v", i, err)
+		}
+	}
+	return router, nil
+}
+
+// handler creates the struct handler or func handler.
+func (h *HandlerSpec) handler(baseDir, routerDir, defaultType string) (Handler, error) {
+	if h == nil {
+		return nil, fmt.Errorf("empty handler")
+	}
+	typ := h.Type
+	if typ == "" {
+		typ = defaultType
+	}
+	dir := routerDir
+	if h.Dir != "" {
+		dir = joinDir(baseDir, h.Dir)
+	}
+	switch typ {
+	case "func":
+		if len(h.Fields) > 0 {
+			return nil, fmt.Errorf("%s: func handler can not have fields", h.Name)
+		}
+		return &FuncHandler{
+			Dir:          dir,
+			UrlPath:      h.UrlPath,
+			Name:         h.Name,
+			Note:         h.Note,
+			ServeContent: h.Serve,
+			Return:       h.Return,
+			Method:       faygo.Methodset(h.Method),
+		}, nil
+	case "struct":
+		var fields = make([]Field, 0, len(h.Fields))
+		for i, f := range h.Fields {
+			if f == nil || f.Name == "" {
+				return nil, fmt.Errorf("%s: fields[%d]: the name must be setted", h.Name, i)
+			}
+			typ := f.Type
+			if typ == "" {
+				typ = "string"
+			}
+			fields = append(fields, Field{
+				Type:      typ,
+				Name:      f.Name,
+				ParamName: f.ParamName,
+				In:        f.In,
+				Required:  f.Required,
+				Nonzero:   f.Nonzero,
+				Len:       f.Len,
+				Range:     f.Range,
+				Regexp:    f.Regexp,
+				Maxmb:     f.Maxmb,
+				Err:       f.Err,
+				Desc:      f.Desc,
+				OtherTags: f.OtherTags,
+			})
+		}
+		return &StructHandler{
+			Dir:          dir,
+			UrlPath:      h.UrlPath,
+			Name:         h.Name,
+			Fields:       fields,
+			ServeContent: h.Serve,
+			Note:         h.Note,
+			Return:       h.Return,
+			Method:       faygo.Methodset(h.Method),
+		}, nil
+	}
+	return nil, fmt.Errorf("%s: unknown handler type %q, use struct or func", h.Name, typ)
+}
+
+// joinDir returns dir if it is absolute, else joins it to baseDir.
+func joinDir(baseDir, dir string) string {
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(baseDir, dir)
+}
@@ -0,0 +1,165 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSpec = `
+frames:
+  - name: myapp
+    version: "1.0"
+    router:
+      func: Route
+      dir: router
+      handlers:
+        - name: Index
+          type: func
+          dir: handler
+          url: /
+          method: GET
+        - name: Login
+          dir: handler
+          url: /user/login
+          method: POST
+          note: user login
+          return: "{}"
+          fields:
+            - {name: Name, in: formData, required: true, len: "1:10"}
+            - {name: Age, type: uint8, in: formData, range: "1:100"}
+            - {name: Avatar, type: "*multipart.FileHeader", in: formData}
+      middlewares:
+        - {name: Token, dir: middleware, url: /user}
+      statics:
+        - {name: static fs, url: /static, root: ./static, nocompress: true}
+`
+
+// tempModule creates the example.com/app module in a temporary dir.
+func tempModule(t *testing.T) string {
+	root, err := ioutil.TempDir("", "fay-spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/app\n"), 0666)
+	if err != nil {
+		os.RemoveAll(root)
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestLoadSpec(t *testing.T) {
+	root := tempModule(t)
+	defer os.RemoveAll(root)
+	specFile := filepath.Join(root, "api.yaml")
+	err := ioutil.WriteFile(specFile, []byte(testSpec), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := LoadSpec(specFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	main := m.Create()
+	for _, want := range []string{`"example.com/app/router"`, `router.Route(faygo.New("myapp", "1.0"))`} {
+		if !strings.Contains(main, want) {
+			t.Errorf("main.go does not contain %s:\n%s", want, main)
+		}
+	}
+	if len(m.frames) != 1 {
+		t.Fatalf("got %d frames, want 1", len(m.frames))
+	}
+	router := m.frames[0].router.Create()
+	for _, want := range []string{
+		`"example.com/app/handler"`,
+		`"example.com/app/middleware"`,
+		`frame.NewNamedAPI("Index", "GET", "/", handler.Index)`,
+		`frame.NewNamedAPI("user login", "POST", "/login", &handler.Login{})`,
+		`.Use(middleware.Token)`,
+		`frame.NewNamedStatic("static fs", "/static", "./static", true, false)`,
+	} {
+		if !strings.Contains(router, want) {
+			t.Errorf("router does not contain %s:\n%s", want, router)
+		}
+	}
+
+	if err = m.Output(); err != nil {
+		t.Fatal(err)
+	}
+	login, err := ioutil.ReadFile(filepath.Join(root, "handler", "login.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"`param:\"<in:formData><required><len:1:10>\"`",
+		"`param:\"<in:formData><range:1:100>\"`",
+		`"mime/multipart"`,
+	} {
+		if !strings.Contains(string(login), want) {
+			t.Errorf("login.go does not contain %s:\n%s", want, login)
+		}
+	}
+}
+
+func TestParseSpecJSON(t *testing.T) {
+	spec, err := ParseSpec([]byte(`{"frames": [{"name": "myapp", "router": {"func": "Route", "handlers": [{"name": "Index", "url": "/", "fields": [{"name": "id", "in": "path"}]}]}}]}`), ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := spec.Frames[0].Router.Handlers[0]
+	if h.Name != "Index" || len(h.Fields) != 1 || h.Fields[0].In != "path" {
+		t.Errorf("unexpected handler: %+v", h)
+	}
+}
+
+func TestSpecErrors(t *testing.T) {
+	var cases = []struct {
+		spec string
+		want string
+	}{
+		{`frames: []`, "no frame"},
+		{`frames: [{name: myapp}]`, "frames[0]: the router must be setted"},
+		{`frames: [{name: myapp, router: {func: Route, handlers: [{name: Index, type: method}]}}]`, `frames[0].router: handlers[0]: Index: unknown handler type "method"`},
+		{`frames: [{name: myapp, router: {func: Route, handlers: [{name: Index, fields: [{in: query}]}]}}]`, "handlers[0]: Index: fields[0]: the name must be setted"},
+		{`frames: [{name: myapp, router: {func: Route, handlers: [{name: A, url: /a}, {name: B, url: /a}]}}]`, "handlers[1]: urlPath conflicts: /a"},
+	}
+	root := tempModule(t)
+	defer os.RemoveAll(root)
+	for _, c := range cases {
+		spec, err := ParseSpec([]byte(c.spec), ".yaml")
+		if err == nil {
+			_, err = spec.Main(root)
+		}
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("spec %s: got error %v, want %q", c.spec, err, c.want)
+		}
+	}
+	for _, c := range []struct{ spec, ext string }{
+		{`frame: []`, ".yaml"},
+		{`{"frame": []}`, ".json"},
+		{`{"frames": [{"name": "myapp", "routr": {}}]}`, ".json"},
+		{`{"frames": []} {}`, ".json"},
+	} {
+		if _, err := ParseSpec([]byte(c.spec), c.ext); err == nil {
+			t.Errorf("spec %s: unknown key or trailing data should fail", c.spec)
+		}
+	}
+}
@@ -108,11 +108,20 @@ type (
 
 // Output creates struct handler file.
 func (s *StructHandler) Output() error {
-	code, err := s.Create()
+	f, err := s.DryRun()
 	if err != nil {
 		return err
 	}
-	return writeFile(s.Dir, faygo.SnakeString(s.Name)+".go", code)
+	return f.Write()
+}
+
+// DryRun returns struct handler file without writing it.
+func (s *StructHandler) DryRun() (*File, error) {
+	code, err := s.Create()
+	if err != nil {
+		return nil, err
+	}
+	return newHandlerFile(s.Dir, faygo.SnakeString(s.Name)+".go", code)
 }
 
 // Create returns struct handler's codes
@@ -159,15 +168,11 @@ func (s *StructHandler) TryMainPkg(mainPkgPath string) {
 }
 
 // PkgPath returns the package path, e.g `github.com/henrylee2cn/fay/test`
-func (s *StructHandler) PkgPath() string {
+func (s *StructHandler) PkgPath() (string, error) {
 	if s.isMainPkg || s.Dir == "" {
-		return ""
-	}
-	dirs := strings.Split(s.Dir, "/src/")
-	if len(dirs) < 2 {
-		faygo.Fatalf("You must generate codes in the `src` or its offspring directory!")
+		return "", nil
 	}
-	return strings.Join(dirs[1:], "/src/")
+	return ImportPath(s.Dir)
 }
 
 // PkgName returns the package name, e.g `handler`
@@ -298,27 +303,7 @@ func (s *StructHandler) createStruct() string {
 	if s.ServeContent != "" {
 		serve += fmt.Sprintf("\n%s", s.ServeContent)
 	} else {
-		for i, filename := range s.fileParams {
-			var equal = "="
-			if i == 0 {
-				equal = ":" + equal
-			}
-			serve += fmt.Sprintf("\n    info, err %s ctx.SaveFile(%q, false)", equal, faygo.SnakeString(filename))
-			serve += fmt.Sprintf("\n    if err != nil {\n        return ctx.JSON(412, faygo.Map{\"error\": err.Error()}, true)\n    }")
-			serve += fmt.Sprintf("\n    %s.%sUrl = info.Url", s.sign, filename)
-		}
-		for i, filename := range s.filesParams {
-			var equal = "="
-			if i == 0 {
-				equal = ":" + equal
-			}
-			serve += fmt.Sprintf("\n    infos, err %s ctx.SaveFiles(%q, false)", equal, faygo.SnakeString(filename))
-			serve += fmt.Sprintf("\n    if err != nil {\n        return ctx.JSON(412, faygo.Map{\"error\": err.Error()}, true)\n    }")
-			serve += fmt.Sprintf("\n    for _, info := range infos {")
-			serve += fmt.Sprintf("\n        %s.%sUrls = append(%s.%sUrls, info.Url)", s.sign, filename, s.sign, filename)
-			serve += fmt.Sprintf("\n    }")
-		}
-		serve += fmt.Sprintf("\n    return ctx.JSON(200, %s, true)", s.sign)
+		serve += serveCode(s.sign, s.fileParams, s.filesParams)
 	}
 	serve += fmt.Sprintf("\n}\n")
 
@@ -334,3 +319,30 @@ func (s *StructHandler) createStruct() string {
 
 	return structure + serve + doc
 }
+
+// serveCode returns the generated body of Serve, which saves the uploaded files.
+func serveCode(sign string, fileParams, filesParams []string) string {
+	var serve string
+	for i, filename := range fileParams {
+		var equal = "="
+		if i == 0 {
+			equal = ":" + equal
+		}
+		serve += fmt.Sprintf("\n    info, err %s ctx.SaveFile(%q, false)", equal, faygo.SnakeString(filename))
+		serve += fmt.Sprintf("\n    if err != nil {\n        return ctx.JSON(412, faygo.Map{\"error\": err.Error()}, true)\n    }")
+		serve += fmt.Sprintf("\n    %s.%sUrl = info.Url", sign, filename)
+	}
+	for i, filename := range filesParams {
+		var equal = "="
+		if i == 0 {
+			equal = ":" + equal
+		}
+		serve += fmt.Sprintf("\n    infos, err %s ctx.SaveFiles(%q, false)", equal, faygo.SnakeString(filename))
+		serve += fmt.Sprintf("\n    if err != nil {\n        return ctx.JSON(412, faygo.Map{\"error\": err.Error()}, true)\n    }")
+		serve += fmt.Sprintf("\n    for _, info := range infos {")
+		serve += fmt.Sprintf("\n        %s.%sUrls = append(%s.%sUrls, info.Url)", sign, filename, sign, filename)
+		serve += fmt.Sprintf("\n    }")
+	}
+	serve += fmt.Sprintf("\n    return ctx.JSON(200, %s, true)", sign)
+	return serve
+}
@@ -0,0 +1,452 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/henrylee2cn/faygo"
+	"gopkg.in/yaml.v2"
+)
+
+type (
+	// swaggerDoc the part of a Swagger 2.0 document used by the importer
+	swaggerDoc struct {
+		Swagger             string                      `yaml:"swagger"`
+		OpenAPI             string                      `yaml:"openapi"`
+		BasePath            string                      `yaml:"basePath"`
+		Paths               map[string]*swaggerPathItem `yaml:"paths"`
+		Parameters          map[string]*swaggerParam    `yaml:"parameters"`
+		SecurityDefinitions map[string]interface{}      `yaml:"securityDefinitions"`
+	}
+	swaggerPathItem struct {
+		Ref        string            `yaml:"$ref"`
+		Get        *swaggerOperation `yaml:"get"`
+		Put        *swaggerOperation `yaml:"put"`
+		Post       *swaggerOperation `yaml:"post"`
+		Delete     *swaggerOperation `yaml:"delete"`
+		Options    *swaggerOperation `yaml:"options"`
+		Head       *swaggerOperation `yaml:"head"`
+		Patch      *swaggerOperation `yaml:"patch"`
+		Parameters []*swaggerParam   `yaml:"parameters"`
+	}
+	swaggerOperation struct {
+		OperationID string                      `yaml:"operationId"`
+		Summary     string                      `yaml:"summary"`
+		Description string                      `yaml:"description"`
+		Parameters  []*swaggerParam             `yaml:"parameters"`
+		Responses   map[string]*swaggerResponse `yaml:"responses"`
+		Deprecated  bool                        `yaml:"deprecated"`
+		Security    []interface{}               `yaml:"security"`
+	}
+	swaggerResponse struct {
+		Description string                 `yaml:"description"`
+		Examples    map[string]interface{} `yaml:"examples"`
+	}
+	swaggerItems struct {
+		Type   string        `yaml:"type"`
+		Format string        `yaml:"format"`
+		Items  *swaggerItems `yaml:"items"`
+	}
+	swaggerParam struct {
+		Ref              string        `yaml:"$ref"`
+		Name             string        `yaml:"name"`
+		In               string        `yaml:"in"`
+		Description      string        `yaml:"description"`
+		Required         bool          `yaml:"required"`
+		Type             string        `yaml:"type"`
+		Format           string        `yaml:"format"`
+		Items            *swaggerItems `yaml:"items"`
+		CollectionFormat string        `yaml:"collectionFormat"`
+		Default          interface{}   `yaml:"default"`
+		Maximum          *float64      `yaml:"maximum"`
+		ExclusiveMaximum bool          `yaml:"exclusiveMaximum"`
+		Minimum          *float64      `yaml:"minimum"`
+		ExclusiveMinimum bool          `yaml:"exclusiveMinimum"`
+		MaxLength        *int          `yaml:"maxLength"`
+		MinLength        *int          `yaml:"minLength"`
+		Pattern          string        `yaml:"pattern"`
+		MaxItems         *int          `yaml:"maxItems"`
+		MinItems         *int          `yaml:"minItems"`
+		UniqueItems      bool          `yaml:"uniqueItems"`
+		Enum             []interface{} `yaml:"enum"`
+		MultipleOf       *float64      `yaml:"multipleOf"`
+		Schema           interface{}   `yaml:"schema"`
+	}
+	// swaggerImporter converts a Swagger 2.0 document
+	swaggerImporter struct {
+		doc        *swaggerDoc
+		handlerDir string
+		names      map[string]bool
+		warnings   []string
+	}
+)
+
+// ImportSwagger creates the router of a Swagger 2.0 document, in YAML or JSON.
+// Each operation becomes a StructHandler in handlerDir, and its parameters
+// become the fields; the operations of a path share its url path. The constructs that have no equivalent in
+// faygo are returned as warnings, e.g. `GET /pets/{id}: parameter id: enum is unsupported`.
+func ImportSwagger(data []byte, routerFunc, routerDir, handlerDir string) (*Router, []string, error) {
+	var doc = new(swaggerDoc)
+	err := yaml.Unmarshal(data, doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if doc.OpenAPI != "" {
+		return nil, nil, errors.New("OpenAPI " + doc.OpenAPI + " is unsupported, only Swagger 2.0 is.")
+	}
+	if doc.Swagger != "2.0" {
+		return nil, nil, errors.New("It is not a Swagger 2.0 document.")
+	}
+	router, err := NewRouter(routerFunc, routerDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	im := &swaggerImporter{
+		doc:        doc,
+		handlerDir: handlerDir,
+		names:      make(map[string]bool),
+	}
+	if len(doc.SecurityDefinitions) > 0 {
+		im.warnf("securityDefinitions are unsupported")
+	}
+	var paths []string
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		for _, handler := range im.pathHandlers(p, doc.Paths[p]) {
+			err = router.AddHandler(handler)
+			if err != nil {
+				im.warnf("%s %s: %v, skipped", handler.Method, p, err)
+			}
+		}
+	}
+	return router, im.warnings, nil
+}
+
+func (im *swaggerImporter) warnf(format string, a ...interface{}) {
+	im.warnings = append(im.warnings, fmt.Sprintf(format, a...))
+}
+
+// pathHandlers converts the operations of the path into StructHandlers.
+func (im *swaggerImporter) pathHandlers(p string, item *swaggerPathItem) []*StructHandler {
+	if item == nil {
+		return nil
+	}
+	if item.Ref != "" {
+		im.warnf("%s: $ref of path item is unsupported", p)
+		return nil
+	}
+	var handlers []*StructHandler
+	for _, op := range []struct {
+		method string
+		*swaggerOperation
+	}{
+		{"GET", item.Get},
+		{"PUT", item.Put},
+		{"POST", item.Post},
+		{"DELETE", item.Delete},
+		{"OPTIONS", item.Options},
+		{"HEAD", item.Head},
+		{"PATCH", item.Patch},
+	} {
+		if op.swaggerOperation == nil {
+			continue
+		}
+		where := op.method + " " + p
+		if op.Deprecated {
+			im.warnf("%s: deprecated is unsupported", where)
+		}
+		if len(op.Security) > 0 {
+			im.warnf("%s: security is unsupported", where)
+		}
+		handlers = append(handlers, &StructHandler{
+			Dir:     im.handlerDir,
+			UrlPath: swaggerUrlPath(im.doc.BasePath, p),
+			Method:  faygo.Methodset(op.method),
+			Name:    im.handlerName(op.OperationID, op.method, p),
+			Fields:  im.fields(where, item.Parameters, op.Parameters),
+			Note:    strings.TrimSpace(op.Summary + "\n" + op.Description),
+			Return:  swaggerReturn(op.Responses),
+		})
+	}
+	return handlers
+}
+
+// handlerName returns a unique handler name from the operationId, or from the method and the path.
+func (im *swaggerImporter) handlerName(operationID, method, p string) string {
+	name := operationID
+	if name == "" {
+		name = strings.ToLower(method) + " " + p
+	}
+	name = faygo.CamelString(goIdentifier(name))
+	if name == "" || name[0] < 'A' || name[0] > 'Z' {
+		name = "Api" + name
+	}
+	unique := name
+	for i := 2; im.names[unique]; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+	if unique != name {
+		im.warnf("%s %s: handler name %s is used, renamed to %s", method, p, name, unique)
+	}
+	im.names[unique] = true
+	return unique
+}
+
+// fields converts the path item and operation parameters, the latter override the former.
+func (im *swaggerImporter) fields(where string, common, own []*swaggerParam) []Field {
+	var params []*swaggerParam
+	var index = make(map[string]int)
+	for _, list := range [][]*swaggerParam{common, own} {
+		for _, param := range list {
+			param = im.resolve(where, param)
+			if param == nil {
+				continue
+			}
+			key := param.In + " " + param.Name
+			if i, ok := index[key]; ok {
+				params[i] = param
+				continue
+			}
+			index[key] = len(params)
+			params = append(params, param)
+		}
+	}
+	var fields []Field
+	var names = make(map[string]bool)
+	var hasBody, hasForm bool
+	for _, param := range params {
+		field, ok := im.field(where, param)
+		if !ok {
+			continue
+		}
+		if names[field.Name] {
+			im.warnf("%s: parameter %s: field name %s is used, skipped", where, param.Name, field.Name)
+			continue
+		}
+		names[field.Name] = true
+		hasBody = hasBody || field.In == "body"
+		hasForm = hasForm || field.In == "formData"
+		fields = append(fields, field)
+	}
+	if hasBody && hasForm {
+		im.warnf("%s: body and formData parameters can not exist at the same time", where)
+	}
+	return fields
+}
+
+// resolve returns the parameter that $ref points to.
+func (im *swaggerImporter) resolve(where string, param *swaggerParam) *swaggerParam {
+	if param == nil || param.Ref == "" {
+		return param
+	}
+	const prefix = "#/parameters/"
+	if strings.HasPrefix(param.Ref, prefix) {
+		if p := im.doc.Parameters[strings.TrimPrefix(param.Ref, prefix)]; p != nil {
+			return p
+		}
+	}
+	im.warnf("%s: parameter $ref %s is unresolvable", where, param.Ref)
+	return nil
+}
+
+// field converts a parameter to a Field.
+func (im *swaggerImporter) field(where string, param *swaggerParam) (Field, bool) {
+	where = where + ": parameter " + param.Name
+	field := Field{
+		Name:     faygo.CamelString(goIdentifier(param.Name)),
+		In:       param.In,
+		Required: param.Required,
+		Regexp:   param.Pattern,
+		Desc:     param.Description,
+	}
+	if field.Name == "" || field.Name[0] < 'A' || field.Name[0] > 'Z' {
+		field.Name = "Param" + field.Name
+	}
+	if faygo.SnakeString(field.Name) != param.Name {
+		field.ParamName = param.Name
+	}
+	switch param.In {
+	case "path", "query", "header", "formData":
+		typ, err := swaggerType(param.Type, param.Format, param.Items)
+		if err != nil {
+			im.warnf("%s: %v, skipped", where, err)
+			return field, false
+		}
+		field.Type = typ
+	case "body":
+		// the schema has no generated type, so the raw body is bound
+		field.Type = "[]byte"
+		if param.Schema != nil {
+			im.warnf("%s: body schema is unsupported, bound as []byte", where)
+		}
+	default:
+		im.warnf("%s: location %q is unsupported, skipped", where, param.In)
+		return field, false
+	}
+	if param.MinLength != nil || param.MaxLength != nil {
+		field.Len = intPtrString(param.MinLength) + ":" + intPtrString(param.MaxLength)
+	}
+	if param.Minimum != nil || param.Maximum != nil {
+		field.Range = floatPtrString(param.Minimum) + ":" + floatPtrString(param.Maximum)
+	}
+	for _, unsupported := range []struct {
+		name string
+		set  bool
+	}{
+		{"exclusiveMinimum", param.ExclusiveMinimum},
+		{"exclusiveMaximum", param.ExclusiveMaximum},
+		{"enum", len(param.Enum) > 0},
+		{"default", param.Default != nil},
+		{"multipleOf", param.MultipleOf != nil},
+		{"minItems", param.MinItems != nil},
+		{"maxItems", param.MaxItems != nil},
+		{"uniqueItems", param.UniqueItems},
+	} {
+		if unsupported.set {
+			im.warnf("%s: %s is unsupported", where, unsupported.name)
+		}
+	}
+	switch param.CollectionFormat {
+	case "", "csv", "multi":
+	default:
+		im.warnf("%s: collectionFormat %s is unsupported", where, param.CollectionFormat)
+	}
+	return field, true
+}
+
+// swaggerType returns the Go type of a Swagger parameter type.
+func swaggerType(typ, format string, items *swaggerItems) (string, error) {
+	switch typ {
+	case "string":
+		return "string", nil
+	case "integer":
+		switch format {
+		case "int32", "int64":
+			return format, nil
+		}
+		return "int", nil
+	case "number":
+		if format == "float" {
+			return "float32", nil
+		}
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "file":
+		return "*multipart.FileHeader", nil
+	case "array":
+		if items == nil {
+			return "", errors.New("array without items")
+		}
+		if items.Type == "array" {
+			return "", errors.New("nested array is unsupported")
+		}
+		elem, err := swaggerType(items.Type, items.Format, nil)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + elem, nil
+	}
+	return "", fmt.Errorf("type %q is unsupported", typ)
+}
+
+// swaggerUrlPath returns the faygo path, e.g. `/v1/pets/:id` for `/v1` and `/pets/{id}`.
+func swaggerUrlPath(basePath, p string) string {
+	p = strings.TrimRight(basePath, "/") + "/" + strings.TrimLeft(p, "/")
+	var segments = strings.Split(p, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			segments[i] = ":" + s[1:len(s)-1]
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// swaggerReturn returns the example, or the description, of the first successful response.
+func swaggerReturn(responses map[string]*swaggerResponse) string {
+	var codes []string
+	for code := range responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range append(codes, "default") {
+		resp := responses[code]
+		if resp == nil || (code != "default" && !strings.HasPrefix(code, "2")) {
+			continue
+		}
+		if example, ok := resp.Examples["application/json"]; ok {
+			b, err := json.MarshalIndent(jsonValue(example), "", "  ")
+			if err == nil {
+				return "// JSON\n" + string(b)
+			}
+		}
+		return resp.Description
+	}
+	return ""
+}
+
+// jsonValue converts the YAML maps to JSON objects.
+func jsonValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, v := range x {
+			m[fmt.Sprint(k)] = jsonValue(v)
+		}
+		return m
+	case []interface{}:
+		for i, v := range x {
+			x[i] = jsonValue(v)
+		}
+	}
+	return v
+}
+
+// goIdentifier replaces the characters that are invalid in a Go identifier with `_`.
+func goIdentifier(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, s)
+	for strings.Contains(s, "__") {
+		s = strings.Replace(s, "__", "_", -1)
+	}
+	return strings.Trim(s, "_")
+}
+
+func intPtrString(i *int) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.Itoa(*i)
+}
+
+func floatPtrString(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
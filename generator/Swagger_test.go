@@ -0,0 +1,156 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSwagger = `
+swagger: "2.0"
+basePath: /v1
+parameters:
+  limit:
+    name: limit
+    in: query
+    type: integer
+    format: int32
+    minimum: 1
+    maximum: 100
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      summary: list pets
+      parameters:
+        - $ref: "#/parameters/limit"
+        - {name: tags, in: query, type: array, items: {type: string}}
+      responses:
+        "200":
+          description: the pets
+          examples:
+            application/json: [{id: 1, name: kitty}]
+    post:
+      operationId: createPet
+      parameters:
+        - {name: name, in: formData, type: string, required: true, minLength: 1, maxLength: 10, pattern: "^\\w+$"}
+        - {name: photo, in: formData, type: file}
+        - {name: kind, in: formData, type: string, enum: [cat, dog]}
+      responses:
+        "201": {description: created}
+  /pets/{petId}:
+    parameters:
+      - {name: petId, in: path, type: integer, format: int64, required: true}
+    get:
+      summary: show a pet
+      responses:
+        "200": {description: the pet}
+    delete:
+      responses:
+        "204": {description: deleted}
+`
+
+func TestImportSwagger(t *testing.T) {
+	root := tempModule(t)
+	defer os.RemoveAll(root)
+	router, warnings, err := ImportSwagger([]byte(testSwagger), "Route", filepath.Join(root, "router"), filepath.Join(root, "handler"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "POST /pets: parameter kind: enum is unsupported"; !containsString(warnings, want) {
+		t.Errorf("warnings %q do not contain %q", warnings, want)
+	}
+	if len(router.nodes) != 4 {
+		t.Fatalf("got %d nodes, want 4", len(router.nodes))
+	}
+
+	// each operation is a handler
+	var wantHandlers = []struct {
+		method, name string
+		fields       []Field
+	}{
+		{"GET", "ListPets", []Field{
+			{Type: "int32", Name: "Limit", In: "query", Range: "1:100", isParam: true},
+			{Type: "[]string", Name: "Tags", In: "query", isParam: true},
+		}},
+		{"POST", "CreatePet", []Field{
+			{Type: "string", Name: "Name", In: "formData", Required: true, Len: "1:10", Regexp: `^\w+$`, isParam: true},
+			{Type: "*multipart.FileHeader", Name: "Photo", In: "formData", isParam: true},
+			{Type: "string", Name: "Kind", In: "formData", isParam: true},
+		}},
+		{"GET", "GetPetsPetId", []Field{
+			{Type: "int64", Name: "PetId", ParamName: "petId", In: "path", Required: true, isParam: true},
+		}},
+		{"DELETE", "DeletePetsPetId", []Field{
+			{Type: "int64", Name: "PetId", ParamName: "petId", In: "path", Required: true, isParam: true},
+		}},
+	}
+	for i, want := range wantHandlers {
+		h := router.nodes[i].handler.(*StructHandler)
+		if string(h.Method) != want.method || h.Name != want.name {
+			t.Errorf("handler %d: got %s %s, want %s %s", i, h.Method, h.Name, want.method, want.name)
+		}
+		if !reflect.DeepEqual(h.Fields, want.fields) {
+			t.Errorf("%s: got fields\n%+v\nwant\n%+v", h.Name, h.Fields, want.fields)
+		}
+	}
+	pets := router.nodes[0].handler.(*StructHandler)
+	if pets.UrlPath != "v1/pets" || !strings.Contains(pets.Return, `"name": "kitty"`) {
+		t.Errorf("unexpected handler %s %q", pets.UrlPath, pets.Return)
+	}
+	pet := router.nodes[2].handler.(*StructHandler)
+	if pet.UrlPath != "v1/pets/:petId" || pet.Note != "show a pet" {
+		t.Errorf("unexpected handler %s %q", pet.UrlPath, pet.Note)
+	}
+
+	code := router.Create()
+	for _, want := range []string{
+		`frame.NewNamedAPI("list pets", "GET", "/pets", &handler.ListPets{})`,
+		`frame.NewNamedAPI("CreatePet", "POST", "/pets", &handler.CreatePet{})`,
+		// faygo appends the path params of the struct to the pattern
+		`frame.NewNamedAPI("show a pet", "GET", "/pets", &handler.GetPetsPetId{})`,
+		`frame.NewNamedAPI("DeletePetsPetId", "DELETE", "/pets", &handler.DeletePetsPetId{})`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("router does not contain %s:\n%s", want, code)
+		}
+	}
+}
+
+func TestImportSwaggerErrors(t *testing.T) {
+	for doc, want := range map[string]string{
+		`openapi: 3.0.0`:               "OpenAPI 3.0.0 is unsupported",
+		`{"swagger": "1.2"}`:           "not a Swagger 2.0 document",
+		`{"swagger": "2.0", "paths": `: "yaml",
+	} {
+		_, _, err := ImportSwagger([]byte(doc), "Route", "./test/router", "./test/handler")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got error %v, want %q", doc, err, want)
+		}
+	}
+}
+
+func containsString(a []string, s string) bool {
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -17,9 +17,6 @@ package generator
 import (
 	"errors"
 	"fmt"
-	"os"
-	"os/exec"
-	"path"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -39,25 +36,11 @@ func Output(fullfilename string, content string) error {
 }
 
 func writeFile(dir, shortname, code string) error {
-	err := os.MkdirAll(dir, 0777)
+	f, err := newFile(dir, shortname, code)
 	if err != nil {
 		return err
 	}
-	filename := path.Join(dir, shortname)
-	f, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	_, err = f.WriteString(code)
-	f.Close()
-	faygo.Printf("[fay] Created %s", filename)
-	if filepath.Ext(shortname) == ".go" {
-		cmd := exec.Command("gofmt", "-w", filename)
-		cmd.Stderr = os.Stderr
-		cmd.Stdout = os.Stdout
-		return cmd.Run()
-	}
-	return nil
+	return f.Write()
 }
 
 func cleanDir(dir *string) error {
@@ -0,0 +1,112 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// goProject describes how the go tool has to be invoked for a project.
+type goProject struct {
+	dir      string // directory of the main package
+	modFile  string // the nearest go.mod, empty in GOPATH mode
+	workFile string // the nearest go.work, if any
+	gopath   string // GOPATH root of a legacy project
+}
+
+// detectGoProject finds the nearest go.mod (and go.work) above dir.
+// If there is none, it falls back to the legacy GOPATH `/src/` layout.
+func detectGoProject(dir string) (*goProject, error) {
+	dir = filepath.Clean(dir)
+	p := &goProject{dir: dir}
+	p.modFile = findUp(dir, "go.mod")
+	if p.modFile != "" {
+		p.workFile = findUp(dir, "go.work")
+		return p, nil
+	}
+	slashDir := filepath.ToSlash(dir) + "/"
+	n := strings.LastIndex(slashDir, "/src/")
+	if n == -1 {
+		return nil, errors.New("neither a go.mod was found nor is the project under GOPATH src: " + dir)
+	}
+	p.gopath = filepath.FromSlash(slashDir[:n])
+	return p, nil
+}
+
+// goMod runs `go mod` with the args in dir in module mode, e.g. `init` for
+// a new project which is neither in a module nor under GOPATH src.
+func goMod(dir string, args ...string) error {
+	cmd := exec.Command("go", append([]string{"mod"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO111MODULE=on")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// modulePath returns the module path of the `fay new` argument, e.g.
+// `example.com/myapp`, or appname if it is an absolute or a parent path.
+func modulePath(arg, appname string) string {
+	p := filepath.ToSlash(filepath.Clean(arg))
+	if filepath.IsAbs(arg) || strings.HasPrefix(p, "/") || p == ".." || strings.HasPrefix(p, "../") {
+		return appname
+	}
+	return p
+}
+
+// isModule returns whether the project is built in module mode.
+func (p *goProject) isModule() bool {
+	return p.modFile != ""
+}
+
+// env returns the environment of the go tool, the later entries win.
+func (p *goProject) env(environ []string) []string {
+	if p.isModule() {
+		return append(environ, "GO111MODULE=on")
+	}
+	return append(environ, "GO111MODULE=off", "GOPATH="+p.gopath)
+}
+
+// String describes the build mode.
+func (p *goProject) String() string {
+	switch {
+	case p.workFile != "":
+		return "module mode (" + p.modFile + ", workspace " + p.workFile + ")"
+	case p.isModule():
+		return "module mode (" + p.modFile + ")"
+	default:
+		return "GOPATH mode (GOPATH=" + p.gopath + ")"
+	}
+}
+
+// findUp returns the path of the first file with the given name
+// in dir or one of its parents.
+func findUp(dir, name string) string {
+	for {
+		filename := filepath.Join(dir, name)
+		if isFile(filename) {
+			return filename
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDetectGoProject(t *testing.T) {
+	root, err := ioutil.TempDir("", "fay-gomod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if findUp(root, "go.mod") != "" || findUp(root, "go.work") != "" || strings.Contains(filepath.ToSlash(root), "/src/") {
+		t.Skip("the temp dir is in a module or under a GOPATH src")
+	}
+	for _, name := range []string{
+		"mod/go.mod",
+		"mod/cmd/app/main.go",
+		"work/go.work",
+		"work/lib/go.mod",
+		"gopath/src/example.com/app/main.go",
+		"gopath/src/example.com/app/src/x/main.go",
+		"none/main.go",
+	} {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte("module example.com/m\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	abs := func(name string) string {
+		if name == "" {
+			return ""
+		}
+		return filepath.Join(root, filepath.FromSlash(name))
+	}
+	var cases = []struct {
+		dir      string
+		modFile  string
+		workFile string
+		gopath   string
+		env      []string
+		err      bool
+	}{
+		{dir: "mod", modFile: "mod/go.mod", env: []string{"GO111MODULE=on"}},
+		{dir: "mod/cmd/app", modFile: "mod/go.mod", env: []string{"GO111MODULE=on"}},
+		{dir: "work/lib", modFile: "work/lib/go.mod", workFile: "work/go.work", env: []string{"GO111MODULE=on"}},
+		{dir: "gopath/src/example.com/app", gopath: "gopath", env: []string{"GO111MODULE=off", "GOPATH=" + abs("gopath")}},
+		// the last `/src/` wins
+		{dir: "gopath/src/example.com/app/src/x", gopath: "gopath/src/example.com/app", env: []string{"GO111MODULE=off", "GOPATH=" + abs("gopath/src/example.com/app")}},
+		{dir: "none", err: true},
+	}
+	for _, c := range cases {
+		p, err := detectGoProject(abs(c.dir) + string(filepath.Separator))
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: got %s, want an error", c.dir, p)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.dir, err)
+			continue
+		}
+		want := &goProject{dir: abs(c.dir), modFile: abs(c.modFile), workFile: abs(c.workFile), gopath: abs(c.gopath)}
+		if *p != *want {
+			t.Errorf("%s: got %+v, want %+v", c.dir, *p, *want)
+		}
+		if p.isModule() != (c.modFile != "") {
+			t.Errorf("%s: got module mode %v", c.dir, p.isModule())
+		}
+		if env := p.env(nil); !reflect.DeepEqual(env, c.env) {
+			t.Errorf("%s: got env %q, want %q", c.dir, env, c.env)
+		}
+	}
+}
+
+func TestModulePath(t *testing.T) {
+	var cases = []struct {
+		arg  string
+		want string
+	}{
+		{"myapp", "myapp"},
+		{"example.com/myapp", "example.com/myapp"},
+		{"./example.com/myapp/", "example.com/myapp"},
+		{"../myapp", "myapp"},
+		{"/tmp/myapp", "myapp"},
+	}
+	for _, c := range cases {
+		if got := modulePath(filepath.FromSlash(c.arg), "myapp"); got != c.want {
+			t.Errorf("modulePath(%q) = %q, want %q", c.arg, got, c.want)
+		}
+	}
+}
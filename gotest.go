@@ -0,0 +1,306 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/henrylee2cn/faygo"
+)
+
+// testFlags are the options of `fay test`.
+type testFlags struct {
+	set                                   *flag.FlagSet
+	config, exts, include, exclude, delay string
+	run, flags                            string
+}
+
+func newTestFlags() *testFlags {
+	f := &testFlags{set: flag.NewFlagSet("test", flag.ExitOnError)}
+	f.set.Usage = testappHelp
+	f.set.StringVar(&f.config, "config", "", "config file")
+	f.set.StringVar(&f.exts, "exts", "", "watched file extensions")
+	f.set.StringVar(&f.include, "include", "", "globs of extra watched files")
+	f.set.StringVar(&f.exclude, "exclude", "", "globs of ignored files and directories")
+	f.set.StringVar(&f.delay, "delay", "", "delay before testing")
+	f.set.StringVar(&f.run, "run", "", "run only the tests matching the regexp")
+	f.set.StringVar(&f.flags, "flags", "", "extra go test flags")
+	return f
+}
+
+// apply overrides the watch config with the options that were set.
+func (f *testFlags) apply(c *fayConfig) {
+	f.set.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "exts":
+			c.Watch.Exts = splitList(f.exts)
+		case "include":
+			c.Watch.Include = splitList(f.include)
+		case "exclude":
+			c.Watch.Exclude = splitList(f.exclude)
+		case "delay":
+			c.Watch.Delay = f.delay
+		}
+	})
+}
+
+// testArgs returns the go test flags.
+func (f *testFlags) testArgs() []string {
+	args := strings.Fields(f.flags)
+	if f.run != "" {
+		args = append(args, "-run", f.run)
+	}
+	return args
+}
+
+func testapp(args []string) {
+	flags := newTestFlags()
+	args = parseInterspersed(flags.set, args)
+	switch len(args) {
+	case 0, 1:
+		initVar(args)
+	default:
+		testappHelp()
+		return
+	}
+	if err := os.Chdir(curpath); err != nil {
+		faygo.Fatalf("[fay] Test project fail: %v", err)
+	}
+	setupConfig(flags.config, flags.apply)
+	project, err := detectGoProject(curpath)
+	if err != nil {
+		faygo.Fatalf("[fay] Can not test: %v", err)
+	}
+	testArgs := flags.testArgs()
+	runTests(context.Background(), project, []string{"./..."}, testArgs)
+	newWatcher(func(ctx context.Context, files []string) error {
+		pkgs, err := affectedPackages(project, files)
+		if err != nil {
+			faygo.Errorf("[fay] Fail to list packages[ %s ]", err)
+			return nil
+		}
+		if len(pkgs) == 0 {
+			faygo.Printf("[fay] No package is affected")
+			return nil
+		}
+		return runTests(ctx, project, pkgs, testArgs)
+	})
+	select {}
+}
+
+// listedPackage is the part of the `go list -json` output used by fay test.
+type listedPackage struct {
+	ImportPath string
+	Dir        string
+	Standard   bool
+	Deps       []string
+}
+
+// affectedPackages returns the project packages of the changed files and
+// their reverse dependencies, including the transitive dependencies of the tests.
+func affectedPackages(project *goProject, files []string) ([]string, error) {
+	// with -test, the deps of the test binary `p.test` are the transitive
+	// closure of the imports of p and of its tests.
+	cmd := exec.Command("go", "list", "-e", "-deps", "-test", "-json", "./...")
+	cmd.Dir = project.dir
+	cmd.Env = cfg.environ(project.env(os.Environ()))
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	var local []*listedPackage
+	testDeps := make(map[string][]string)
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		pkg := new(listedPackage)
+		err := dec.Decode(pkg)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if pkg.Standard || !isSubpath(curpath, pkg.Dir) {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(pkg.ImportPath, ".test"):
+			testDeps[strings.TrimSuffix(pkg.ImportPath, ".test")] = pkg.Deps
+		case strings.Contains(pkg.ImportPath, " ["):
+			// a package recompiled for a test, e.g. "p [p.test]"
+		default:
+			local = append(local, pkg)
+		}
+	}
+
+	changed := make(map[string]bool)
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		for _, pkg := range local {
+			if filepath.Clean(pkg.Dir) == dir {
+				changed[pkg.ImportPath] = true
+			}
+		}
+	}
+	var affected []string
+	for _, pkg := range local {
+		if changed[pkg.ImportPath] || dependsOn(changed, pkg.Deps, testDeps[pkg.ImportPath]) {
+			affected = append(affected, pkg.ImportPath)
+		}
+	}
+	sort.Strings(affected)
+	return affected, nil
+}
+
+func dependsOn(changed map[string]bool, lists ...[]string) bool {
+	for _, list := range lists {
+		for _, pkg := range list {
+			if i := strings.Index(pkg, " ["); i >= 0 {
+				pkg = pkg[:i]
+			}
+			if changed[pkg] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isSubpath returns whether path is dir or is in dir.
+func isSubpath(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// testEvent is an event of `go test -json`.
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Output  string
+	Elapsed float64
+}
+
+// testResult is the result of a package.
+type testResult struct {
+	action         string
+	elapsed        float64
+	passed, failed int
+	output         bytes.Buffer
+}
+
+// runTests runs go test for the packages and prints a summary per package.
+// The output of a package is only printed when it fails. It returns the error
+// of the context if the test is canceled.
+func runTests(ctx context.Context, project *goProject, pkgs []string, testArgs []string) error {
+	state.Lock()
+	defer state.Unlock()
+	faygo.Printf("[fay] Start test: %s", strings.Join(pkgs, " "))
+	args := append([]string{"test", "-json"}, testArgs...)
+	cmd := exec.CommandContext(ctx, "go", append(args, pkgs...)...)
+	cmd.Dir = project.dir
+	cmd.Env = cfg.environ(project.env(os.Environ()))
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		faygo.Errorf("[fay] Fail to test[ %s ]", err)
+		return nil
+	}
+	if err = cmd.Start(); err != nil {
+		faygo.Errorf("[fay] Fail to test[ %s ]", err)
+		return nil
+	}
+	results := make(map[string]*testResult)
+	var order []string
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		var e testEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			fmt.Println(scanner.Text())
+			continue
+		}
+		if e.Package == "" {
+			// the build output and failures are not events of a package
+			os.Stdout.WriteString(e.Output)
+			continue
+		}
+		r := results[e.Package]
+		if r == nil {
+			r = new(testResult)
+			results[e.Package] = r
+			order = append(order, e.Package)
+		}
+		switch e.Action {
+		case "output":
+			r.output.WriteString(e.Output)
+		case "pass", "fail", "skip":
+			if e.Test == "" {
+				r.action = e.Action
+				r.elapsed = e.Elapsed
+			} else if e.Action == "pass" {
+				r.passed++
+			} else if e.Action == "fail" {
+				r.failed++
+			}
+		}
+	}
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		faygo.Printf("[fay] Test canceled by new changes")
+		return ctx.Err()
+	}
+
+	var failed int
+	for _, pkg := range order {
+		if r := results[pkg]; r.action != "pass" && r.action != "skip" {
+			failed++
+			os.Stdout.Write(r.output.Bytes())
+		}
+	}
+	faygo.Printf("[fay] Test summary:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, pkg := range order {
+		r := results[pkg]
+		switch r.action {
+		case "pass":
+			fmt.Fprintf(w, "    ok\t%s\t%.2fs\t%d passed\n", pkg, r.elapsed, r.passed)
+		case "skip":
+			fmt.Fprintf(w, "    ?\t%s\t\t[no test files]\n", pkg)
+		default:
+			fmt.Fprintf(w, "    FAIL\t%s\t%.2fs\t%d passed, %d failed\n", pkg, r.elapsed, r.passed, r.failed)
+		}
+	}
+	w.Flush()
+	if failed > 0 || err != nil {
+		faygo.Errorf("[fay] ============== Test failed ===================")
+		return nil
+	}
+	faygo.Printf("[fay] Test was successful")
+	return nil
+}
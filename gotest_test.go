@@ -0,0 +1,62 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAffectedPackages(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+	// b imports a, and only the tests of c import b
+	root, restore := tempProject(t, map[string]string{
+		"go.mod":      "module example.com/m\n\ngo 1.16\n",
+		"a/a.go":      "package a\n\nconst A = 1\n",
+		"b/b.go":      "package b\n\nimport \"example.com/m/a\"\n\nconst B = a.A\n",
+		"c/c.go":      "package c\n",
+		"c/c_test.go": "package c\n\nimport (\n\t\"testing\"\n\n\t\"example.com/m/b\"\n)\n\nfunc TestC(t *testing.T) { _ = b.B }\n",
+		"d/d.go":      "package d\n",
+		"docs/x.md":   "",
+	})
+	defer restore()
+	project, err := detectGoProject(curpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases = []struct {
+		file string
+		want []string
+	}{
+		{"a/a.go", []string{"example.com/m/a", "example.com/m/b", "example.com/m/c"}},
+		{"b/b.go", []string{"example.com/m/b", "example.com/m/c"}},
+		{"c/c_test.go", []string{"example.com/m/c"}},
+		{"d/d.go", []string{"example.com/m/d"}},
+		{"docs/x.md", nil},
+	}
+	for _, c := range cases {
+		got, err := affectedPackages(project, []string{filepath.Join(root, filepath.FromSlash(c.file))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %q, want %q", c.file, got, c.want)
+		}
+	}
+}
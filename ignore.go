@@ -0,0 +1,230 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// gitignore matches the paths of the project against its `.gitignore` files,
+// and the ones of its parent dirs up to the git repository root.
+type gitignore struct {
+	root   string   // the git repository root, or the project dir outside a repository
+	prefix []string // the project dir relative to the root
+	lock   sync.Mutex
+	rules  map[string][]ignoreRule // rules of the `.gitignore` of each dir, by the dir relative to the root
+}
+
+// ignoreRule is a pattern line of a `.gitignore` file.
+type ignoreRule struct {
+	pattern  string // without the `!`, the leading `/` and the trailing `/`
+	negate   bool   // `!pattern` re-includes the matched paths
+	dirOnly  bool   // `pattern/` only matches directories
+	anchored bool   // a pattern with a `/` is relative to the `.gitignore` dir, else it matches a name at any depth
+}
+
+// gitignored is the `.gitignore` matcher of the watched project.
+var gitignored *gitignore
+
+// newGitignore returns the matcher of the paths relative to the project dir.
+func newGitignore(dir string) *gitignore {
+	dir = filepath.Clean(dir)
+	g := &gitignore{
+		root:  dir,
+		rules: make(map[string][]ignoreRule),
+	}
+	if top := gitRoot(dir); top != "" {
+		if rel, err := filepath.Rel(top, dir); err == nil && rel != "." {
+			g.root = top
+			g.prefix = strings.Split(filepath.ToSlash(rel), "/")
+		}
+	}
+	return g
+}
+
+// gitRoot returns the dir or its nearest parent holding a `.git` dir,
+// or a `.git` file of a worktree or a submodule, or "" if there is none.
+func gitRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// fromRoot returns the path segments relative to the root
+// of the slash separated path relative to the project dir.
+func (g *gitignore) fromRoot(rel string) []string {
+	segs := append([]string{}, g.prefix...)
+	if rel != "." && rel != "" {
+		segs = append(segs, strings.Split(rel, "/")...)
+	}
+	return segs
+}
+
+// load returns the rules of the `.gitignore` in the dir, reading it once.
+func (g *gitignore) load(dir string) []ignoreRule {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if rules, ok := g.rules[dir]; ok {
+		return rules
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(g.root, filepath.FromSlash(dir), ".gitignore"))
+	rules := parseGitignore(string(data))
+	g.rules[dir] = rules
+	return rules
+}
+
+// forget drops the rules of the project dir, e.g. after its `.gitignore` changed.
+func (g *gitignore) forget(dir string) {
+	if g == nil {
+		return
+	}
+	g.lock.Lock()
+	delete(g.rules, strings.Join(g.fromRoot(dir), "/"))
+	g.lock.Unlock()
+}
+
+// ignored returns whether the slash separated path relative to the project dir is ignored,
+// a path in an ignored dir is ignored too. The project dir itself is never ignored.
+func (g *gitignore) ignored(rel string, isDir bool) bool {
+	if g == nil || rel == "." || rel == "" {
+		return false
+	}
+	segs := g.fromRoot(rel)
+	for i := len(g.prefix) + 1; i < len(segs); i++ {
+		if g.match(segs[:i], true) {
+			return true
+		}
+	}
+	return g.match(segs, isDir)
+}
+
+// match applies the rules from the root down to the parent dir of the path,
+// the last matching rule wins.
+func (g *gitignore) match(segs []string, isDir bool) bool {
+	var ignored bool
+	for i := 0; i < len(segs); i++ {
+		for _, rule := range g.load(strings.Join(segs[:i], "/")) {
+			if rule.match(segs[i:], isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// match returns whether the path segments relative to the `.gitignore` dir match.
+func (r *ignoreRule) match(segs []string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.anchored {
+		return matchSegments(strings.Split(r.pattern, "/"), segs)
+	}
+	ok, _ := path.Match(r.pattern, segs[len(segs)-1])
+	return ok
+}
+
+// parseGitignore parses the content of a `.gitignore` file.
+func parseGitignore(content string) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if !strings.HasSuffix(line, `\ `) {
+			line = strings.TrimRight(line, " ")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		rule.anchored = strings.Contains(line, "/")
+		rule.pattern = strings.TrimPrefix(line, "/")
+		if rule.pattern == "" {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// matchSegments matches the path segments against the glob segments,
+// a `**` segment matches zero or more segments.
+func matchSegments(glob, segs []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			glob = glob[1:]
+			if len(glob) == 0 {
+				return true
+			}
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(glob, segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(glob[0], segs[0]); !ok {
+			return false
+		}
+		glob, segs = glob[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
+
+// mayMatchUnder returns whether the glob may match a path in the dir,
+// e.g. `build/view/*.tpl` and `**/*.tpl` for the dir `build`.
+func mayMatchUnder(glob, dir string) bool {
+	globSegs := strings.Split(strings.TrimSuffix(glob, "/"), "/")
+	if len(globSegs) == 1 {
+		return false
+	}
+	for _, seg := range strings.Split(dir, "/") {
+		if len(globSegs) == 0 {
+			return false
+		}
+		if globSegs[0] == "**" {
+			return true
+		}
+		if ok, _ := path.Match(globSegs[0], seg); !ok {
+			return false
+		}
+		globSegs = globSegs[1:]
+	}
+	return len(globSegs) > 0
+}
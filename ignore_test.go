@@ -0,0 +1,197 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitignore(t *testing.T) {
+	root, err := ioutil.TempDir("", "fay-gitignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	files := map[string]string{
+		".gitignore": strings.Join([]string{
+			"# comment",
+			"*.log",
+			"!keep.log",
+			"/build/",
+			"**/tmp/**",
+			"docs/**/*.bak",
+			"node_modules",
+			`\#hash`,
+		}, "\n"),
+		"sub/.gitignore": "local.txt\n!debug.log\n",
+	}
+	for name, content := range files {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var cases = []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"main.go", false, false},
+		{"a.log", false, true},
+		{"sub/x/a.log", false, true},
+		// negation
+		{"keep.log", false, false},
+		{"sub/x/keep.log", false, false},
+		{"sub/debug.log", false, false},
+		{"debug.log", false, true},
+		// a file in an ignored dir can not be re-included
+		{"build/keep.log", false, true},
+		// a trailing `/` only matches dirs, a leading `/` anchors to the `.gitignore` dir
+		{"build", true, true},
+		{"build", false, false},
+		{"build/main.go", false, true},
+		{"sub/build", true, false},
+		// `**` matches zero or more dirs
+		{"tmp/a.go", false, true},
+		{"a/b/tmp/c/d.go", false, true},
+		{"tmpl/a.go", false, false},
+		{"docs/a.bak", false, true},
+		{"docs/x/y/a.bak", false, true},
+		{"other/docs/a.bak", false, false},
+		// a pattern without `/` matches at any depth
+		{"node_modules", true, true},
+		{"sub/node_modules/pkg/index.js", false, true},
+		{"#hash", false, true},
+		// the nested `.gitignore` applies to its dir only
+		{"sub/local.txt", false, true},
+		{"sub/x/local.txt", false, true},
+		{"local.txt", false, false},
+	}
+	g := newGitignore(root)
+	for _, c := range cases {
+		if got := g.ignored(c.rel, c.isDir); got != c.want {
+			t.Errorf("ignored(%q, %v) = %v, want %v", c.rel, c.isDir, got, c.want)
+		}
+	}
+}
+
+func TestGitignoreParent(t *testing.T) {
+	root, err := ioutil.TempDir("", "fay-gitignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	// the project is apps/web in the repository, and the `.gitignore` of
+	// the repository root and of apps apply with paths relative to their dirs
+	files := map[string]string{
+		"outside/.gitignore":               "*.go\n",
+		"outside/repo/.git/HEAD":           "ref: refs/heads/master\n",
+		"outside/repo/.gitignore":          "*.log\n/top.txt\n/apps/web/dist/\nweb/\n",
+		"outside/repo/apps/.gitignore":     "/web/tmp/\n!keep.log\n",
+		"outside/repo/apps/web/.gitignore": "local.txt\n",
+	}
+	for name, content := range files {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var cases = []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"main.go", false, false},
+		{"a.log", false, true},
+		{"x/keep.log", false, false},
+		{"top.txt", false, false},
+		{"dist", true, true},
+		{"dist/app.js", false, true},
+		{"x/dist", true, false},
+		{"tmp/a.go", false, true},
+		{"local.txt", false, true},
+		// the project dir is never ignored, but its subdirs may be
+		{".", true, false},
+		{"x/web/a.go", false, true},
+	}
+	g := newGitignore(filepath.Join(root, "outside", "repo", "apps", "web"))
+	for _, c := range cases {
+		if got := g.ignored(c.rel, c.isDir); got != c.want {
+			t.Errorf("ignored(%q, %v) = %v, want %v", c.rel, c.isDir, got, c.want)
+		}
+	}
+	// the rules of a project dir are read again after forgetting them
+	name := filepath.Join(root, "outside", "repo", "apps", "web", ".gitignore")
+	if err := ioutil.WriteFile(name, []byte("other.txt\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	g.forget(".")
+	if g.ignored("local.txt", false) || !g.ignored("other.txt", false) {
+		t.Error("the changed .gitignore of the project dir was not read again")
+	}
+}
+
+func TestMatchGlobs(t *testing.T) {
+	var cases = []struct {
+		glob string
+		rel  string
+		want bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "a/b/main.go", true},
+		{"a/*.go", "a/b/main.go", false},
+		{"a/**/*.go", "a/main.go", true},
+		{"a/**/*.go", "a/b/c/main.go", true},
+		{"**/view/*.tpl", "view/index.tpl", true},
+		{"**/view/*.tpl", "x/view/index.tpl", true},
+		{"**/view/*.tpl", "x/view/y/index.tpl", false},
+		{"static/", "static", true},
+	}
+	for _, c := range cases {
+		if got := matchGlobs([]string{c.glob}, c.rel); got != c.want {
+			t.Errorf("matchGlobs(%q, %q) = %v, want %v", c.glob, c.rel, got, c.want)
+		}
+	}
+}
+
+func TestMayMatchUnder(t *testing.T) {
+	var cases = []struct {
+		glob string
+		dir  string
+		want bool
+	}{
+		{"build/view/*.tpl", "build", true},
+		{"build/view/*.tpl", "build/view", true},
+		{"build/view/*.tpl", "build/view/x", false},
+		{"build/view/*.tpl", "dist", false},
+		{"**/*.tpl", "build/x/y", true},
+		{"*.tpl", "build", false},
+	}
+	for _, c := range cases {
+		if got := mayMatchUnder(c.glob, c.dir); got != c.want {
+			t.Errorf("mayMatchUnder(%q, %q) = %v, want %v", c.glob, c.dir, got, c.want)
+		}
+	}
+}
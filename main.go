@@ -24,20 +24,51 @@
 //  The commands are:
 //          new        create, compile and run (monitor changes) a new faygo project
 //          run        compile and run (monitor changes) an any existing go project
+//          test       run the tests of the changed packages and their dependents (monitor changes)
+//          build      cross-compile release binaries with version info and checksums
+//          pack       bundle the app binary with its static, view and config files
+//          gen        generate the faygo project code from a YAML or JSON API spec
+//          routes     list the routes of the router trees of an existing project
 //
-//  fay new appname [apptpl]
-//          appname    specifies the path of the new faygo project
+//  fay new [options] appname [apptpl]
+//          appname    specifies the path of the new faygo project, and its module path
+//                     with a new go.mod when it is neither in a module nor under GOPATH src
 //          apptpl     optionally, specifies the faygo project template type
+//          options    list the templates, set the template variables, or run non-interactively
 //
-//  fay run [appname]
+//  fay run [options] [appname]
 //          appname    optionally, specifies the path of the new project
+//          options    override the project config file `fay.yaml` or `fay.toml`
+//
+//  fay test [options] [appname]
+//          appname    optionally, specifies the path of the project
+//          options    override the watch settings and pass go test flags
+//
+//  fay build [options] [appname]
+//          appname    optionally, specifies the path of the project
+//          options    specify the targets, the output directory and the version
+//
+//  fay pack [options] [appname]
+//          appname    optionally, specifies the path of the project
+//          options    specify the target, the archive format and the packed files
+//
+//  fay gen [options] spec.yaml
+//          spec.yaml  YAML or JSON file describing the frames, routers, handlers and statics
+//          options    import a Swagger 2.0 document, export an OpenAPI 3 document, or preview the diff
+//
+//  fay routes [options] [appname]
+//          appname    optionally, specifies the path of the project
+//          options    print the routes in JSON
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/henrylee2cn/fay/model"
 	"github.com/henrylee2cn/faygo"
@@ -58,10 +89,36 @@ func main() {
 		newapp(os.Args[2:])
 	case "run":
 		runapp(os.Args[2:])
+	case "test":
+		testapp(os.Args[2:])
+	case "build":
+		buildapp(os.Args[2:])
+	case "pack":
+		packapp(os.Args[2:])
+	case "gen":
+		genapp(os.Args[2:])
+	case "routes":
+		routesapp(os.Args[2:])
+	default:
+		help()
 	}
 }
 
 func newapp(args []string) {
+	set := flag.NewFlagSet("new", flag.ExitOnError)
+	set.Usage = newappHelp
+	list := set.Bool("list", false, "list the project templates")
+	vars := make(templateVars)
+	set.Var(vars, "var", "template variable name=value")
+	force := set.Bool("force", false, "overwrite the existing project path without asking")
+	set.BoolVar(force, "yes", false, "alias of -force")
+	noOverwrite := set.Bool("no-overwrite", false, "fail if the project path exists")
+	noRun := set.Bool("no-run", false, "do not build and run the project after creating it")
+	args = parseInterspersed(set, args)
+	if *list {
+		listTemplates()
+		return
+	}
 	switch len(args) {
 	case 1:
 		initVar(args)
@@ -72,36 +129,137 @@ func newapp(args []string) {
 		newappHelp()
 		return
 	}
+	if *force && *noOverwrite {
+		faygo.Fatalf("[fay] The -force and -no-overwrite options are mutually exclusive")
+	}
+	tpl, err := model.LookupTemplate(apptpl)
+	if err == nil {
+		_, err = tpl.Values(vars)
+	}
+	if err != nil {
+		faygo.Fatalf("[fay] %v", err)
+	}
 	faygo.Printf("[fay] Create a faygo project named `%s` in the `%s` path.", appname, curpath)
 	if isExist(curpath) {
-		faygo.Printf("[fay] The project path has conflic, do you want to build in: %s\n", curpath)
-		faygo.Printf("[fay] Do you want to overwrite it? [yes|no]]  ")
-		if !askForConfirmation() {
-			faygo.Fatalf("[fay] Cancel...")
-			return
+		switch {
+		case *force:
+			faygo.Printf("[fay] The project path exists, overwrite it: %s", curpath)
+		case *noOverwrite:
+			faygo.Fatalf("[fay] The project path exists: %s", curpath)
+		case !isTerminal(os.Stdin):
+			faygo.Fatalf("[fay] The project path exists: %s\n[fay] The input is not a terminal, use -force to overwrite it", curpath)
+		default:
+			faygo.Printf("[fay] The project path has conflic, do you want to build in: %s\n", curpath)
+			faygo.Printf("[fay] Do you want to overwrite it? [yes|no]]  ")
+			if !askForConfirmation() {
+				faygo.Fatalf("[fay] Cancel...")
+				return
+			}
 		}
 	}
 
 	faygo.Printf("[fay] Start create project...")
 
-	switch apptpl {
-	case "simple":
-		model.SimplePro(curpath, appname)
-	default:
-		faygo.Fatalf("[fay] `%s` template does not exist, reference:\n[simple]\n", apptpl)
+	// outside a module and GOPATH, the project is a module of the argument path
+	_, err = detectGoProject(curpath)
+	newModule := err != nil
+	if newModule {
+		if err = os.MkdirAll(curpath, 0755); err == nil {
+			err = goMod(curpath, "init", modulePath(args[0], appname))
+		}
+		if err != nil {
+			faygo.Fatalf("[fay] Create project fail: %v", err)
+		}
+	}
+
+	if err = tpl.Create(curpath, appname, vars); err != nil {
+		faygo.Fatalf("[fay] Create project fail: %v", err)
+	}
+	if newModule {
+		if err = goMod(curpath, "tidy"); err != nil {
+			faygo.Warningf("[fay] Fail to add the requirements[ %v ], run `go mod tidy` in the project", err)
+		}
 	}
 
 	faygo.Printf("[fay] Create was successful")
+	if *noRun {
+		return
+	}
 
 	if err := os.Chdir(curpath); err != nil {
 		faygo.Fatalf("[fay] Create project fail: %v", err)
 	}
-	autobuild()
-	newWatcher()
-	select {}
+	setupConfig("", nil)
+	serve()
+}
+
+// listTemplates prints the built-in and the user templates with their variables.
+func listTemplates() {
+	tpls, err := model.Templates()
+	if err != nil {
+		faygo.Fatalf("[fay] Load templates fail: %v", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TEMPLATE\tSOURCE\tDESCRIPTION")
+	for _, tpl := range tpls {
+		source := "built-in"
+		if tpl.Dir != "" {
+			source = tpl.Dir
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", tpl.Name, source, tpl.Desc)
+		for _, v := range tpl.Vars {
+			desc := v.Desc
+			if v.Required {
+				desc += " (required)"
+			}
+			fmt.Fprintf(w, "  -var %s=%s\t\t%s\n", v.Name, v.Default, desc)
+		}
+	}
+	w.Flush()
+	fmt.Printf("\nuser templates: %s\n", model.TemplateDir())
+}
+
+// templateVars are the `-var name=value` options of `fay new`.
+type templateVars map[string]string
+
+func (v templateVars) String() string {
+	var a []string
+	for name, value := range v {
+		a = append(a, name+"="+value)
+	}
+	return strings.Join(a, " ")
+}
+
+func (v templateVars) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("want name=value, got %q", s)
+	}
+	v[s[:i]] = s[i+1:]
+	return nil
+}
+
+// parseInterspersed parses the flags before and after the positional args,
+// the args after `--` are all positional. All the commands parse their flags with it.
+func parseInterspersed(set *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		set.Parse(args)
+		rest := set.Args()
+		if len(rest) == 0 {
+			return positional
+		}
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			return append(positional, rest...)
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
 }
 
 func runapp(args []string) {
+	flags := newRunFlags("run")
+	args = parseInterspersed(flags.set, args)
 	switch len(args) {
 	case 0, 1:
 		initVar(args)
@@ -112,9 +270,8 @@ func runapp(args []string) {
 	if err := os.Chdir(curpath); err != nil {
 		faygo.Fatalf("[fay] Create project fail: %v", err)
 	}
-	autobuild()
-	newWatcher()
-	select {}
+	setupConfig(flags.config, flags.apply)
+	serve()
 }
 
 const helpInfo = `Fay Usage:
@@ -123,25 +280,234 @@ const helpInfo = `Fay Usage:
 The commands are:
         new        create, compile and run (monitor changes) a new faygo project
         run        compile and run (monitor changes) an any existing go project
+        test       run the tests of the changed packages and their dependents (monitor changes)
+        build      cross-compile release binaries with version info and checksums
+        pack       bundle the app binary with its static, view and config files
+        gen        generate the faygo project code from a YAML or JSON API spec
+        routes     list the routes of the router trees of an existing project
 
-fay new appname [apptpl]
-        appname    specifies the path of the new faygo project
-        apptpl     optionally, specifies the faygo project template type
+fay new [options] appname [apptpl]
+        appname    specifies the path of the new faygo project, and its module path
+                   with a new go.mod when it is neither in a module nor under GOPATH src
+        apptpl     optionally, specifies the faygo project template type, default simple
+        -list      list the built-in and the user templates with their variables
+        -var       template variable name=value, repeatable
+        -force     overwrite the existing project path without asking, alias -yes
+        -no-overwrite  fail if the project path exists, without asking
+        -no-run    do not build and run (monitor changes) the project after creating it
 
-fay run [appname]
+fay run [options] [appname]
         appname    optionally, specifies the path of the new project
+        -config    config file, default fay.yaml, fay.yml or fay.toml in the project
+        -exts      watched file extensions, e.g. .go,.ini
+        -include   globs of extra watched files, e.g. view/*.tpl
+        -exclude   globs of ignored files and directories, e.g. vendor,*_test.go
+        -delay     delay before building after the last change, e.g. 500ms
+        -build     build command, it must accept -o output, e.g. "go build"
+        -flags     build flags, e.g. "-race -tags dev"
+        -output    path of the built binary
+        -cmd       run command, default the built binary
+        -args      arguments of the app, e.g. "-port 8080"
+        -stop-signal   signal asking the app to exit on restart, default SIGTERM
+        -stop-timeout  grace period before killing the app, default 5s
+        -restart       restart policy when the app exits by itself: never, on-failure or always, default never
+        -proxy         address of the live-reload proxy in front of the app, e.g. :3000
+        -proxy-target  URL of the app behind the proxy, default http://127.0.0.1:8080
+        -hold-timeout  max time the proxy holds requests while the app restarts, default 30s
+        -ready-tcp     address accepting connections once the app is ready, e.g. 127.0.0.1:8080
+        -ready-http    URL answering below 400 once the app is ready, e.g. http://127.0.0.1:8080/
+        -ready-log     regexp of the output line printed once the app is ready
+        -ready-timeout max time for the app to get ready, default 30s
+        -procfile      file of the processes supervised next to the app, default Procfile if it exists
+
+fay test [options] [appname]
+        appname    optionally, specifies the path of the project
+        -config    config file, default fay.yaml, fay.yml or fay.toml in the project
+        -exts      watched file extensions, e.g. .go
+        -include   globs of extra watched files, e.g. testdata/*
+        -exclude   globs of ignored files and directories, e.g. vendor
+        -delay     delay before testing after the last change, e.g. 500ms
+        -run       run only the tests matching the regexp
+        -flags     extra go test flags, e.g. "-race -count 1"
+
+fay build [options] [appname]
+        appname    optionally, specifies the path of the project
+        -config    config file, default fay.yaml, fay.yml or fay.toml in the project
+        -targets   GOOS/GOARCH targets, e.g. linux/amd64,darwin/arm64, default the host
+        -o         output directory, default dist
+        -version   version of the release, default git describe --tags --always --dirty
+        -ldflags   extra linker flags, e.g. "-s -w"
+
+fay pack [options] [appname]
+        appname    optionally, specifies the path of the project
+        -config    config file, default fay.yaml, fay.yml or fay.toml in the project
+        -target    GOOS/GOARCH target, e.g. linux/amd64, default the host
+        -format    archive format, tar.gz or zip, default tar.gz
+        -include   globs of the packed files and directories, default static,view,config
+        -exclude   globs of the skipped files and directories, e.g. *.map,view/dev
+        -o         output directory, default dist
+        -version   version of the package, default git describe --tags --always --dirty
+        -ldflags   extra linker flags, e.g. "-s -w"
+
+fay gen [options] spec.yaml
+        spec.yaml  YAML or JSON file describing the frames, routers, handlers and statics
+        -swagger   the file is a Swagger 2.0 document, its paths become struct handlers
+        -dir       project dir of the Swagger 2.0 document, default .
+        -app       app name of the Swagger 2.0 document, default the project dir name
+        -openapi   write the OpenAPI 3 document to the file instead of the code, in YAML for .yaml or .yml, else in JSON
+        -dry-run   print the unified diff of the generated files against the disk instead of writing them
+        -confirm   print the diff of each changed file and ask before writing it
+
+fay routes [options] [appname]
+        appname    optionally, specifies the path of the project
+        -json      print the routes in JSON instead of a table
 `
 
 func help() {
-	fmt.Println(helpInfo)
+	fmt.Print(helpInfo)
 }
 
 func newappHelp() {
-	fmt.Println(helpInfo)
+	fmt.Print(helpInfo)
 }
 
 func runappHelp() {
-	fmt.Println(helpInfo)
+	fmt.Print(helpInfo)
+}
+
+func testappHelp() {
+	fmt.Print(helpInfo)
+}
+
+func buildappHelp() {
+	fmt.Print(helpInfo)
+}
+
+func packappHelp() {
+	fmt.Print(helpInfo)
+}
+
+func genappHelp() {
+	fmt.Print(helpInfo)
+}
+
+func routesappHelp() {
+	fmt.Print(helpInfo)
+}
+
+// runFlags are the command line options that override the config file.
+type runFlags struct {
+	set                                                         *flag.FlagSet
+	config, exts, include, exclude, delay, build, flags, output string
+	cmd, args, stopSignal, stopTimeout, proxy, proxyTarget      string
+	holdTimeout, readyTCP, readyHTTP, readyLog, readyTimeout    string
+	procfile, restart                                           string
+}
+
+func newRunFlags(name string) *runFlags {
+	f := &runFlags{set: flag.NewFlagSet(name, flag.ExitOnError)}
+	f.set.Usage = runappHelp
+	f.set.StringVar(&f.config, "config", "", "config file")
+	f.set.StringVar(&f.exts, "exts", "", "watched file extensions")
+	f.set.StringVar(&f.include, "include", "", "globs of extra watched files")
+	f.set.StringVar(&f.exclude, "exclude", "", "globs of ignored files and directories")
+	f.set.StringVar(&f.delay, "delay", "", "delay before building")
+	f.set.StringVar(&f.build, "build", "", "build command")
+	f.set.StringVar(&f.flags, "flags", "", "build flags")
+	f.set.StringVar(&f.output, "output", "", "path of the built binary")
+	f.set.StringVar(&f.cmd, "cmd", "", "run command")
+	f.set.StringVar(&f.args, "args", "", "arguments of the app")
+	f.set.StringVar(&f.stopSignal, "stop-signal", "", "signal asking the app to exit")
+	f.set.StringVar(&f.stopTimeout, "stop-timeout", "", "grace period before killing the app")
+	f.set.StringVar(&f.restart, "restart", "", "restart policy when the app exits by itself")
+	f.set.StringVar(&f.proxy, "proxy", "", "address of the live-reload proxy")
+	f.set.StringVar(&f.proxyTarget, "proxy-target", "", "URL of the app behind the proxy")
+	f.set.StringVar(&f.holdTimeout, "hold-timeout", "", "max time the proxy holds requests")
+	f.set.StringVar(&f.readyTCP, "ready-tcp", "", "address accepting connections once the app is ready")
+	f.set.StringVar(&f.readyHTTP, "ready-http", "", "URL answering once the app is ready")
+	f.set.StringVar(&f.readyLog, "ready-log", "", "regexp of the output line printed once the app is ready")
+	f.set.StringVar(&f.readyTimeout, "ready-timeout", "", "max time for the app to get ready")
+	f.set.StringVar(&f.procfile, "procfile", "", "file of the processes supervised next to the app")
+	return f
+}
+
+// apply overrides the config with the options that were set.
+func (f *runFlags) apply(c *fayConfig) {
+	f.set.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "exts":
+			c.Watch.Exts = splitList(f.exts)
+		case "include":
+			c.Watch.Include = splitList(f.include)
+		case "exclude":
+			c.Watch.Exclude = splitList(f.exclude)
+		case "delay":
+			c.Watch.Delay = f.delay
+		case "build":
+			c.Build.Cmd = f.build
+		case "flags":
+			c.Build.Flags = strings.Fields(f.flags)
+		case "output":
+			c.Build.Output = f.output
+		case "cmd":
+			c.Run.Cmd = f.cmd
+		case "args":
+			c.Run.Args = strings.Fields(f.args)
+		case "stop-signal":
+			c.Run.StopSignal = f.stopSignal
+		case "stop-timeout":
+			c.Run.StopTimeout = f.stopTimeout
+		case "restart":
+			c.Run.Restart = f.restart
+		case "proxy":
+			c.Proxy.Addr = f.proxy
+		case "proxy-target":
+			c.Proxy.Target = f.proxyTarget
+		case "hold-timeout":
+			c.Proxy.HoldTimeout = f.holdTimeout
+		case "ready-tcp":
+			c.Run.Ready.TCP = f.readyTCP
+		case "ready-http":
+			c.Run.Ready.HTTP = f.readyHTTP
+		case "ready-log":
+			c.Run.Ready.Log = f.readyLog
+		case "ready-timeout":
+			c.Run.Ready.Timeout = f.readyTimeout
+		case "procfile":
+			c.Procfile = f.procfile
+		}
+	})
+}
+
+// serve builds and runs the app and the processes, and rebuilds them on changes.
+func serve() {
+	newProcs()
+	handleSignals()
+	if cfg.Proxy.Addr != "" {
+		startProxy()
+	}
+	autobuild(context.Background())
+	startProcs()
+	newWatcher(onChange)
+	select {}
+}
+
+// setupConfig loads the config of the project in curpath.
+func setupConfig(filename string, override func(*fayConfig)) {
+	c, err := loadConfig(curpath, filename)
+	if err != nil {
+		faygo.Fatalf("[fay] Load config fail: %v", err)
+	}
+	if override != nil {
+		override(c)
+	}
+	if err = c.init(appname); err != nil {
+		faygo.Fatalf("[fay] Load config fail: %v", err)
+	}
+	if c.file != "" {
+		faygo.Printf("[fay] Config file: %s", c.file)
+	}
+	cfg = c
 }
 
 func initVar(args []string) {
@@ -0,0 +1,75 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAskForConfirmation(t *testing.T) {
+	defer func(old *bufio.Reader) { stdin = old }(stdin)
+	var cases = []struct {
+		input string
+		want  []bool // the answers of the questions in a row
+	}{
+		{"yes\n", []bool{true}},
+		{"n\n", []bool{false}},
+		{"maybe\nY\n", []bool{true}},
+		// the answers of the next questions are not lost
+		{"yes\nno\nyes\n", []bool{true, false, true}},
+		// the end of the input is no, without exiting
+		{"", []bool{false, false}},
+		{"maybe", []bool{false}},
+		{"yes", []bool{true, false}},
+	}
+	for _, c := range cases {
+		stdin = bufio.NewReader(strings.NewReader(c.input))
+		var got []bool
+		for range c.want {
+			got = append(got, askForConfirmation())
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: got %v, want %v", c.input, got, c.want)
+		}
+	}
+}
+
+func TestParseInterspersed(t *testing.T) {
+	var cases = []struct {
+		args         []string
+		positional   []string
+		force, noRun bool
+	}{
+		{[]string{"myapp"}, []string{"myapp"}, false, false},
+		{[]string{"-force", "myapp"}, []string{"myapp"}, true, false},
+		{[]string{"myapp", "-yes", "api", "-no-run"}, []string{"myapp", "api"}, true, true},
+		{[]string{"-no-run", "--", "-myapp"}, []string{"-myapp"}, false, true},
+		{[]string{"myapp", "--", "-force"}, []string{"myapp", "-force"}, false, false},
+	}
+	for _, c := range cases {
+		set := flag.NewFlagSet("new", flag.ContinueOnError)
+		force := set.Bool("force", false, "")
+		set.BoolVar(force, "yes", false, "")
+		noRun := set.Bool("no-run", false, "")
+		got := parseInterspersed(set, c.args)
+		if !reflect.DeepEqual(got, c.positional) || *force != c.force || *noRun != c.noRun {
+			t.Errorf("%q: got %q, force %v, no-run %v", c.args, got, *force, *noRun)
+		}
+	}
+}
@@ -24,31 +24,48 @@ import (
 
 // SimplePro output project files.
 func SimplePro(projectDir string, appname string, appVersion ...string) {
+	if err := simplePro(projectDir, appname, appVersion...); err != nil {
+		faygo.Fatalf("[fay] Create project fail:%v", err)
+	}
+}
+
+func simplePro(projectDir string, appname string, appVersion ...string) error {
 	initDir(projectDir)
 
 	router, err := generator.NewRouter("Route", projectDir+"router")
 	if err != nil {
-		faygo.Fatalf("[fay] Create project fail:%v", err)
+		return err
+	}
+	for _, handler := range []generator.Handler{indexHandler, testHandler} {
+		err = router.AddHandler(handler)
+		if err != nil {
+			return err
+		}
+	}
+	err = router.AddMiddleware(tokenWare)
+	if err != nil {
+		return err
 	}
-	router.AddHandler(indexHandler)
-	router.AddHandler(testHandler)
-	router.AddMiddleware(tokenWare)
 
 	project, err := generator.NewMain(projectDir)
 	if err != nil {
-		faygo.Fatalf("[fay] Create project fail:%v", err)
+		return err
+	}
+	err = project.AddFrame(router, appname, appVersion...)
+	if err != nil {
+		return err
 	}
-	project.AddFrame(router, appname, appVersion...)
 	err = project.Output()
 	if err != nil {
-		faygo.Fatalf("[fay] Create project fail:%v", err)
+		return err
 	}
 	for _, file := range otherfiles {
 		err = generator.Output(path.Join(projectDir, file[0]), file[1])
 		if err != nil {
-			faygo.Fatalf("[fay] Create project fail:%v", err)
+			return err
 		}
 	}
+	return nil
 }
 
 func initDir(dir string) {
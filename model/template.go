@@ -0,0 +1,242 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+)
+
+// TemplateManifest the file of a user template declaring its description and variables.
+const TemplateManifest = "template.yaml"
+
+// Template a project template of `fay new`.
+type Template struct {
+	Name string
+	Desc string
+	Vars []TemplateVar
+	// Dir the dir of a user template, empty for the built-in templates
+	Dir    string
+	create func(projectDir, appname string, vars map[string]string) error
+}
+
+// TemplateVar a variable declared by a template, set by `fay new -var name=value`.
+type TemplateVar struct {
+	Name     string `yaml:"name"`
+	Desc     string `yaml:"desc"`
+	Default  string `yaml:"default"`
+	Required bool   `yaml:"required"`
+}
+
+// templateManifest the content of `template.yaml`.
+type templateManifest struct {
+	Desc string        `yaml:"desc"`
+	Vars []TemplateVar `yaml:"vars"`
+}
+
+var builtinTemplates = []*Template{
+	{
+		Name: "simple",
+		Desc: "a func handler, a struct handler, a middleware and the static files",
+		Vars: []TemplateVar{
+			{Name: "version", Desc: "app version"},
+		},
+		create: func(projectDir, appname string, vars map[string]string) error {
+			return simplePro(projectDir, appname, vars["version"])
+		},
+	},
+}
+
+// TemplateDir returns the dir of the user templates, `$FAY_TEMPLATES` if set,
+// else `fay/templates` in `$XDG_CONFIG_HOME` or `~/.config`.
+func TemplateDir() string {
+	if dir := os.Getenv("FAY_TEMPLATES"); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "fay", "templates")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "fay", "templates")
+}
+
+// Templates returns the built-in templates and the user templates sorted by name.
+// A user template overrides the built-in template of the same name.
+func Templates() ([]*Template, error) {
+	tpls := make(map[string]*Template)
+	for _, t := range builtinTemplates {
+		tpls[t.Name] = t
+	}
+	dir := TemplateDir()
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, info := range infos {
+		if !info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		t, err := loadTemplate(filepath.Join(dir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		tpls[t.Name] = t
+	}
+	list := make([]*Template, 0, len(tpls))
+	for _, t := range tpls {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// LookupTemplate returns the template of the name.
+func LookupTemplate(name string) (*Template, error) {
+	list, err := Templates()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, t := range list {
+		if t.Name == name {
+			return t, nil
+		}
+		names = append(names, t.Name)
+	}
+	return nil, fmt.Errorf("`%s` template does not exist, reference: [%s]", name, strings.Join(names, ", "))
+}
+
+// loadTemplate loads the user template in dir.
+func loadTemplate(dir string) (*Template, error) {
+	t := &Template{Name: filepath.Base(dir), Dir: dir}
+	t.create = t.render
+	data, err := ioutil.ReadFile(filepath.Join(dir, TemplateManifest))
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var manifest templateManifest
+	if err = yaml.UnmarshalStrict(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Join(dir, TemplateManifest), err)
+	}
+	t.Desc, t.Vars = manifest.Desc, manifest.Vars
+	for _, v := range t.Vars {
+		if v.Name == "" || v.Name == "AppName" {
+			return nil, fmt.Errorf("%s: invalid variable name %q", filepath.Join(dir, TemplateManifest), v.Name)
+		}
+	}
+	return t, nil
+}
+
+// Create creates the project of the template in projectDir.
+func (t *Template) Create(projectDir, appname string, vars map[string]string) error {
+	values, err := t.Values(vars)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(projectDir, 0755); err != nil {
+		return err
+	}
+	return t.create(projectDir, appname, values)
+}
+
+// Values returns the vars with the defaults of the unset ones.
+// The vars must be declared by the template, and the required ones must be set.
+func (t *Template) Values(vars map[string]string) (map[string]string, error) {
+	values := make(map[string]string, len(t.Vars))
+	for _, v := range t.Vars {
+		value, ok := vars[v.Name]
+		if !ok {
+			if v.Required {
+				return nil, fmt.Errorf("the variable `%s` of the `%s` template must be setted", v.Name, t.Name)
+			}
+			value = v.Default
+		}
+		values[v.Name] = value
+	}
+	for name := range vars {
+		if _, ok := values[name]; !ok {
+			return nil, fmt.Errorf("the `%s` template has no variable `%s`", t.Name, name)
+		}
+	}
+	return values, nil
+}
+
+// render writes the files of the user template to projectDir. The `.tmpl` files
+// and the file paths are executed as text/template with the vars and `AppName`,
+// the other files are copied as they are.
+func (t *Template) render(projectDir, appname string, vars map[string]string) error {
+	data := map[string]string{"AppName": appname}
+	for k, v := range vars {
+		data[k] = v
+	}
+	return filepath.Walk(t.Dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(t.Dir, name)
+		if err != nil || rel == "." || rel == TemplateManifest {
+			return err
+		}
+		rel, err = execute(rel, rel, data)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(projectDir, strings.TrimSuffix(rel, ".tmpl"))
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		content, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(rel, ".tmpl") {
+			s, err := execute(rel, string(content), data)
+			if err != nil {
+				return err
+			}
+			content = []byte(s)
+		}
+		return ioutil.WriteFile(target, content, info.Mode().Perm())
+	})
+}
+
+func execute(name, text string, data map[string]string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err = tpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
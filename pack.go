@@ -0,0 +1,318 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/henrylee2cn/faygo"
+)
+
+// packFlags are the options of `fay pack`.
+type packFlags struct {
+	*releaseFlags
+	target, format, include, exclude string
+}
+
+func newPackFlags() *packFlags {
+	f := &packFlags{releaseFlags: newReleaseFlags("pack", packappHelp)}
+	f.set.StringVar(&f.target, "target", "", "GOOS/GOARCH target")
+	f.set.StringVar(&f.format, "format", "", "archive format")
+	f.set.StringVar(&f.include, "include", "", "globs of the packed files and directories")
+	f.set.StringVar(&f.exclude, "exclude", "", "globs of the skipped files and directories")
+	return f
+}
+
+// apply overrides the pack config with the options that were set.
+func (f *packFlags) apply(c *fayConfig) {
+	f.releaseFlags.apply(c)
+	f.set.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "target":
+			c.Pack.Target = f.target
+		case "format":
+			c.Pack.Format = f.format
+		case "include":
+			c.Pack.Include = splitList(f.include)
+		case "exclude":
+			c.Pack.Exclude = splitList(f.exclude)
+		}
+	})
+}
+
+func packapp(args []string) {
+	flags := newPackFlags()
+	args = parseInterspersed(flags.set, args)
+	switch len(args) {
+	case 0, 1:
+		initVar(args)
+	default:
+		packappHelp()
+		return
+	}
+	if err := os.Chdir(curpath); err != nil {
+		faygo.Fatalf("[fay] Pack project fail: %v", err)
+	}
+	setupConfig(flags.config, flags.apply)
+	archive, err := pack()
+	if err != nil {
+		faygo.Fatalf("[fay] ============== Pack failed ===================\n%v", err)
+	}
+	sum, err := sha256File(archive)
+	if err != nil {
+		faygo.Fatalf("[fay] Pack project fail: %v", err)
+	}
+	faygo.Printf("[fay] Pack was successful: %s\n[fay] SHA-256: %s", archive, sum)
+}
+
+// manifest describes the content of a packed archive.
+type manifest struct {
+	Name      string          `json:"name"`
+	Version   string          `json:"version"`
+	Commit    string          `json:"commit"`
+	BuildTime string          `json:"build_time"`
+	Target    string          `json:"target"`
+	Files     []*manifestFile `json:"files"`
+}
+
+type manifestFile struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	Mode    string `json:"mode"`
+	SHA256  string `json:"sha256"`
+	src     string
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// pack builds the app and writes it with its assets and manifest into an archive.
+func pack() (string, error) {
+	r, err := newRelease()
+	if err != nil {
+		return "", err
+	}
+	goos, goarch, err := parseTarget(cfg.Pack.Target)
+	if err != nil {
+		return "", err
+	}
+	tmpDir, err := ioutil.TempDir("", "fay-pack")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+	binName := appname
+	if goos == "windows" {
+		binName += ".exe"
+	}
+	bin, err := r.build(cfg.Pack.Target, filepath.Join(tmpDir, binName))
+	if err != nil {
+		return "", err
+	}
+
+	m := &manifest{
+		Name:      appname,
+		Version:   r.version,
+		Commit:    r.commit,
+		BuildTime: r.time,
+		Target:    cfg.Pack.Target,
+	}
+	if err = m.add(bin, binName); err != nil {
+		return "", err
+	}
+	if err = collectAssets(m); err != nil {
+		return "", err
+	}
+	manifestData, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	if err = os.MkdirAll(cfg.Release.Output, 0777); err != nil {
+		return "", err
+	}
+	root := fmt.Sprintf("%s-%s", appname, r.version)
+	archive := filepath.Join(cfg.Release.Output, fmt.Sprintf("%s-%s_%s.%s", root, goos, goarch, cfg.Pack.Format))
+	switch cfg.Pack.Format {
+	case "zip":
+		err = writeZip(archive, root, m.Files, manifestData)
+	default:
+		err = writeTarGz(archive, root, m.Files, manifestData)
+	}
+	if err != nil {
+		return "", err
+	}
+	return archive, nil
+}
+
+// add adds a file to the manifest with its archive path.
+func (m *manifest) add(src, dst string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	sum, err := sha256File(src)
+	if err != nil {
+		return err
+	}
+	m.Files = append(m.Files, &manifestFile{
+		Path:    dst,
+		Size:    fi.Size(),
+		Mode:    fi.Mode().Perm().String(),
+		SHA256:  sum,
+		src:     src,
+		mode:    fi.Mode().Perm(),
+		modTime: fi.ModTime(),
+	})
+	return nil
+}
+
+// collectAssets adds the project files matching the include rules, and
+// not matching the exclude rules. A matched directory includes its whole tree.
+func collectAssets(m *manifest) error {
+	output, _ := filepath.Abs(cfg.Release.Output)
+	return filepath.Walk(curpath, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := relPath(name)
+		if rel == "." {
+			return nil
+		}
+		if fi.IsDir() {
+			if strings.HasPrefix(fi.Name(), ".") || name == output || matchGlobs(cfg.Pack.Exclude, rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fi.Mode().IsRegular() || matchGlobs(cfg.Pack.Exclude, rel) || !matchSelfOrParent(cfg.Pack.Include, rel) {
+			return nil
+		}
+		return m.add(name, rel)
+	})
+}
+
+// matchSelfOrParent returns true if rel or one of its parent directories matches the globs.
+func matchSelfOrParent(globs []string, rel string) bool {
+	for p := rel; p != "." && p != "/"; p = path.Dir(p) {
+		if matchGlobs(globs, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeTarGz(archive, root string, files []*manifestFile, manifestData []byte) error {
+	f, err := os.Create(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for _, file := range files {
+		hdr := &tar.Header{
+			Name:    path.Join(root, file.Path),
+			Mode:    int64(file.mode),
+			Size:    file.Size,
+			ModTime: file.modTime,
+		}
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if err = copyFile(tw, file.src); err != nil {
+			return err
+		}
+	}
+	hdr := &tar.Header{
+		Name:    path.Join(root, "manifest.json"),
+		Mode:    0644,
+		Size:    int64(len(manifestData)),
+		ModTime: time.Now(),
+	}
+	if err = tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err = tw.Write(manifestData); err != nil {
+		return err
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	if err = gw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func writeZip(archive, root string, files []*manifestFile, manifestData []byte) error {
+	f, err := os.Create(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, file := range files {
+		hdr := &zip.FileHeader{
+			Name:     path.Join(root, file.Path),
+			Method:   zip.Deflate,
+			Modified: file.modTime,
+		}
+		hdr.SetMode(file.mode)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if err = copyFile(w, file.src); err != nil {
+			return err
+		}
+	}
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     path.Join(root, "manifest.json"),
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(manifestData); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func copyFile(w io.Writer, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
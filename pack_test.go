@@ -0,0 +1,185 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMatchSelfOrParent(t *testing.T) {
+	var cases = []struct {
+		globs []string
+		rel   string
+		want  bool
+	}{
+		{[]string{"static"}, "static", true},
+		{[]string{"static"}, "static/css/a.css", true},
+		{[]string{"static"}, "web/static/a.css", true},
+		{[]string{"static"}, "statics/a.css", false},
+		{[]string{"config/*.ini"}, "config/app.ini", true},
+		{[]string{"config/*.ini"}, "config/x/app.ini", false},
+		{[]string{"view/**"}, "view/a/b.html", true},
+		{[]string{"a", "b"}, "b/c", true},
+		{nil, "a", false},
+		{[]string{"a"}, ".", false},
+	}
+	for _, c := range cases {
+		if got := matchSelfOrParent(c.globs, c.rel); got != c.want {
+			t.Errorf("matchSelfOrParent(%q, %q) = %v, want %v", c.globs, c.rel, got, c.want)
+		}
+	}
+}
+
+func TestCollectAssets(t *testing.T) {
+	root, restore := tempProject(t, map[string]string{
+		"main.go":               "package main\n",
+		"config/app.ini":        "a=1\n",
+		"static/css/a.css":      "body{}\n",
+		"static/js/a.js.map":    "{}\n",
+		"static/.cache/a.css":   "body{}\n",
+		"view/index.html":       "<html></html>\n",
+		"view/empty/x":          "/",
+		"docs/static.md":        "# static\n",
+		"dist/static/old.css":   "body{}\n",
+		"web/static/legacy.css": "body{}\n",
+	})
+	defer restore()
+	cfg.Release.Output = filepath.Join(root, "dist")
+	cfg.Pack.Exclude = []string{"*.map", "web"}
+	m := new(manifest)
+	if err := collectAssets(m); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range m.Files {
+		got = append(got, f.Path)
+	}
+	sort.Strings(got)
+	// the hidden dirs, the output dir and the excluded globs are skipped
+	want := []string{"config/app.ini", "static/css/a.css", "view/index.html"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got files %q, want %q", got, want)
+	}
+	for _, f := range m.Files {
+		if f.Path != "config/app.ini" {
+			continue
+		}
+		// the sha256 of "a=1\n"
+		if f.Size != 4 || f.SHA256 != "fe3209d6d4f51935b391288a43df48d9ddece1a992597ae53387ca16611a9179" {
+			t.Errorf("got size %d and sha256 %s", f.Size, f.SHA256)
+		}
+	}
+}
+
+func TestPackArchives(t *testing.T) {
+	root, restore := tempProject(t, map[string]string{
+		"myapp":            "binary",
+		"static/css/a.css": "body{}\n",
+	})
+	defer restore()
+	m := new(manifest)
+	if err := m.add(filepath.Join(root, "myapp"), "myapp"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.add(filepath.Join(root, "static", "css", "a.css"), "static/css/a.css"); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"myapp-v1/myapp":            "binary",
+		"myapp-v1/static/css/a.css": "body{}\n",
+		"myapp-v1/manifest.json":    "{}",
+	}
+	var cases = []struct {
+		format string
+		write  func(archive, root string, files []*manifestFile, manifestData []byte) error
+		read   func(archive string) (map[string]string, error)
+	}{
+		{"tar.gz", writeTarGz, readTarGz},
+		{"zip", writeZip, readZip},
+	}
+	for _, c := range cases {
+		archive := filepath.Join(root, "myapp."+c.format)
+		if err := c.write(archive, "myapp-v1", m.Files, []byte("{}")); err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.read(archive)
+		if err != nil {
+			t.Errorf("%s: %v", c.format, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got files %q, want %q", c.format, got, want)
+		}
+	}
+}
+
+func readTarGz(archive string) (map[string]string, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[hdr.Name] = string(b)
+	}
+}
+
+func readZip(archive string) (map[string]string, error) {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	files := make(map[string]string)
+	for _, zf := range zr.File {
+		r, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		b, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		files[zf.Name] = string(b)
+	}
+	return files, nil
+}
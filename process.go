@@ -0,0 +1,208 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/henrylee2cn/faygo"
+)
+
+// appProcess is a started process of the app or of a supervised process,
+// with its own process group.
+type appProcess struct {
+	cmd      *exec.Cmd
+	done     chan struct{} // closed when the process has exited
+	err      error         // result of cmd.Wait
+	stopping int32
+	started  time.Time
+	tail     *tailWriter // last lines of the output
+	// logMatcher watches the output for the readiness log line, if any
+	logMatcher *logMatcher
+}
+
+// Restart stops the running app gracefully and starts the new one.
+func Restart() {
+	var start string
+	if isFirstStart {
+		isFirstStart = false
+		faygo.Printf("[fay] Starting app: %s", appname)
+		start = "Start"
+	} else {
+		faygo.Printf("[fay] Restarting app: %s", appname)
+		gate.shut()
+		if p := mainApp.running(); p != nil {
+			p.stop()
+		}
+		start = "Restart"
+	}
+	if err := runHooks("pre_run", cfg.Hooks.PreRun); err != nil {
+		faygo.Errorf("[fay] Fail to start app[ %s ]", err)
+		gate.fail(err)
+		return
+	}
+	begin := time.Now()
+	p, err := mainApp.start(cfg.Run.Ready.log)
+	if err != nil {
+		faygo.Errorf("[fay] Fail to start app[ %s ]", err)
+		gate.fail(err)
+		return
+	}
+	mainApp.setRunning(p)
+	if cfg.Run.Ready.enabled() {
+		faygo.Printf("[fay] Waiting for the app to be ready...")
+	}
+	err = waitReady(p)
+	switch err {
+	case nil:
+	case errNotReady:
+		faygo.Errorf("[fay] %s failed: the app is not ready after %v", start, cfg.Run.Ready.timeout)
+		// the app is still running, so that the requests are no longer held
+		gate.open()
+		return
+	default:
+		faygo.Errorf("[fay] %s failed after %v: %v", start, time.Since(begin).Round(time.Millisecond), err)
+		gate.fail(err)
+		return
+	}
+	faygo.Printf("[fay] %s was successful, ready in %v", start, time.Since(begin).Round(time.Millisecond))
+	gate.open()
+	reloader.reload()
+	if err := runHooks("post_run", cfg.Hooks.PostRun); err != nil {
+		faygo.Warningf("[fay] %v", err)
+	}
+}
+
+// start starts the process in a new process group, and watches its output
+// for the readiness log line if re is not nil.
+func (pr *proc) start(re *regexp.Regexp) (*appProcess, error) {
+	var cmd *exec.Cmd
+	if pr.shell != "" {
+		cmd = shellCommand(pr.shell)
+	} else {
+		cmd = exec.Command(pr.args[0], pr.args[1:]...)
+	}
+	cmd.Dir = pr.dir
+	cmd.Env = cfg.environ(os.Environ())
+	setProcessGroup(cmd)
+	p := &appProcess{
+		cmd:  cmd,
+		done: make(chan struct{}),
+		tail: newTailWriter(cfg.Run.TailLines),
+	}
+	stdout := []io.Writer{pr.stdout, p.tail}
+	stderr := []io.Writer{pr.stderr, p.tail}
+	if re != nil {
+		p.logMatcher = newLogMatcher(re)
+		stdout = append(stdout, p.logMatcher)
+		stderr = append(stderr, p.logMatcher)
+	}
+	cmd.Stdout = io.MultiWriter(stdout...)
+	cmd.Stderr = io.MultiWriter(stderr...)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p.started = time.Now()
+	go func() {
+		p.err = cmd.Wait()
+		close(p.done)
+		if atomic.LoadInt32(&p.stopping) == 1 {
+			if pr == mainApp {
+				faygo.Printf("[fay] Old process was stopped")
+			} else {
+				faygo.Printf("[fay] Old process of %s was stopped", pr.name)
+			}
+		} else {
+			pr.exited(p)
+		}
+	}()
+	return p, nil
+}
+
+// stop sends the stop signal to the process group and waits for the app to exit.
+// After the grace period, the whole group is killed.
+func (p *appProcess) stop() {
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	atomic.StoreInt32(&p.stopping, 1)
+	timeout := cfg.Run.stopTimeout
+	if timeout > 0 {
+		if err := signalGroup(p.cmd, cfg.Run.stopSignal); err != nil {
+			faygo.Printf("[fay] Signal %v -> %v", cfg.Run.stopSignal, err)
+			timeout = 0
+		}
+	}
+	select {
+	case <-p.done:
+		// kills the grandchildren that may still linger
+		killGroup(p.cmd)
+		return
+	case <-time.After(timeout):
+	}
+	if timeout > 0 {
+		faygo.Warningf("[fay] App did not exit within %v, kill it", timeout)
+	}
+	if err := killGroup(p.cmd); err != nil {
+		faygo.Printf("[fay] Kill -> %v", err)
+	}
+	<-p.done
+}
+
+// exitStatus describes the result of cmd.Wait by the exit code or the signal.
+func exitStatus(err error) string {
+	if err == nil {
+		return "exit code 0"
+	}
+	if e, ok := err.(*exec.ExitError); ok {
+		if code := e.ExitCode(); code >= 0 {
+			return fmt.Sprintf("exit code %d", code)
+		}
+		if ws, ok := e.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return fmt.Sprintf("killed by signal %d (%v)", int(ws.Signal()), ws.Signal())
+		}
+	}
+	return err.Error()
+}
+
+// fatalf stops the app and the processes, since they do not share the process
+// group of fay, and exits with the error like faygo.Fatalf.
+func fatalf(format string, args ...interface{}) {
+	stopAll()
+	faygo.Fatalf(format, args...)
+}
+
+// handleSignals stops the app and the processes before fay exits, since they do not
+// share the process group, and so the terminal signals, of fay.
+func handleSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-ch
+		faygo.Printf("[fay] Received %v, stopping app...", sig)
+		stopAll()
+		os.Exit(0)
+	}()
+}
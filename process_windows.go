@@ -0,0 +1,52 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// errConnRefused is the error of a refused connection, WSAECONNREFUSED,
+// which is not syscall.ECONNREFUSED on windows.
+const errConnRefused syscall.Errno = 10061
+
+// parseSignal accepts any name, since windows can only kill a process.
+func parseSignal(name string) (os.Signal, error) {
+	return os.Kill, nil
+}
+
+// setProcessGroup makes the command the root of a new process group.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// signalGroup kills the process tree, since it is the only signal on windows.
+func signalGroup(cmd *exec.Cmd, sig os.Signal) error {
+	return killGroup(cmd)
+}
+
+// killGroup kills the process tree of the command.
+func killGroup(cmd *exec.Cmd) error {
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+}
@@ -0,0 +1,284 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/faygo"
+)
+
+// liveReloadPath is the URL path of the reload events, and with `.js` of the script.
+const liveReloadPath = "/__fay/livereload"
+
+const liveReloadScript = `(function () {
+    if (!window.EventSource) {
+        return;
+    }
+    var source = new EventSource("` + liveReloadPath + `");
+    source.addEventListener("reload", function () {
+        window.location.reload();
+    });
+})();
+`
+
+var liveReloadTag = []byte(`<script src="` + liveReloadPath + `.js"></script>`)
+
+// reloader pushes reload events to the browsers connected to the proxy.
+var reloader = &liveReload{clients: make(map[chan struct{}]bool)}
+
+type liveReload struct {
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+}
+
+// reload asks all the connected browsers to reload the page.
+func (l *liveReload) reload() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.clients) > 0 {
+		faygo.Printf("[fay] Reload %d browser page(s)", len(l.clients))
+	}
+	for ch := range l.clients {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// ServeHTTP streams the reload events with Server-Sent Events.
+func (l *liveReload) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ch := make(chan struct{}, 1)
+	l.mu.Lock()
+	l.clients[ch] = true
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		delete(l.clients, ch)
+		l.mu.Unlock()
+	}()
+
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ch:
+			fmt.Fprint(w, "event: reload\ndata: {}\n\n")
+		case <-ping.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// gate holds the proxied requests while the app is restarting.
+var gate = &appGate{up: make(chan struct{})}
+
+type appGate struct {
+	mu     sync.Mutex
+	up     chan struct{} // closed while the app is up or failed
+	isOpen bool
+	err    error // why the app failed, if it did
+}
+
+// open lets the held and the new requests through.
+func (g *appGate) open() {
+	g.release(nil)
+}
+
+// fail answers the held and the new requests with the error, instead of holding
+// them until the timeout, since the app failed and is not restarting by itself.
+func (g *appGate) fail(err error) {
+	g.release(err)
+}
+
+func (g *appGate) release(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.isOpen {
+		close(g.up)
+		g.isOpen = true
+	}
+	g.err = err
+}
+
+// shut holds the new requests until the gate is opened again.
+func (g *appGate) shut() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.isOpen {
+		g.up = make(chan struct{})
+		g.isOpen = false
+	}
+	g.err = nil
+}
+
+// wait blocks until the app is up, the timeout expires or the request is canceled,
+// and returns the error of the app if it failed.
+func (g *appGate) wait(ctx context.Context, timeout time.Duration) error {
+	g.mu.Lock()
+	up := g.up
+	g.mu.Unlock()
+	select {
+	case <-up:
+		return g.failure()
+	default:
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-up:
+		return g.failure()
+	case <-timer.C:
+		return errors.New("the app is not up after " + timeout.String())
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (g *appGate) failure() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+// holdRequests forwards the requests once the app is up.
+func holdRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := gate.wait(r.Context(), cfg.Proxy.holdTimeout); err != nil {
+			http.Error(w, "[fay] "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// dialRetry retries refused connections until the hold timeout, since the
+// app may listen a while after it was started.
+func dialRetry(ctx context.Context, network, addr string) (net.Conn, error) {
+	var dialer net.Dialer
+	deadline := time.Now().Add(cfg.Proxy.holdTimeout)
+	for {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err == nil || !isConnRefused(err) || time.Now().After(deadline) {
+			return conn, err
+		}
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func isConnRefused(err error) bool {
+	return errors.Is(err, errConnRefused)
+}
+
+// startProxy serves the reverse proxy in front of the app.
+func startProxy() {
+	target, err := url.Parse(cfg.Proxy.Target)
+	if err != nil {
+		fatalf("[fay] Invalid proxy target: %v", err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		// keeps the HTML uncompressed, so that the script can be injected
+		req.Header.Del("Accept-Encoding")
+	}
+	proxy.ModifyResponse = injectLiveReload
+	var handler http.Handler = proxy
+	if cfg.Proxy.holdTimeout > 0 {
+		proxy.Transport = &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DialContext:         dialRetry,
+			MaxIdleConnsPerHost: 16,
+			IdleConnTimeout:     90 * time.Second,
+		}
+		handler = holdRequests(proxy)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(liveReloadPath, reloader)
+	mux.HandleFunc(liveReloadPath+".js", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Header().Set("Cache-Control", "no-cache")
+		fmt.Fprint(w, liveReloadScript)
+	})
+	mux.Handle("/", handler)
+
+	ln, err := net.Listen("tcp", cfg.Proxy.Addr)
+	if err != nil {
+		fatalf("[fay] Fail to start proxy[ %s ]", err)
+	}
+	faygo.Printf("[fay] Proxy %s -> %s", ln.Addr(), target)
+	go func() {
+		err := http.Serve(ln, mux)
+		faygo.Errorf("[fay] Proxy was stopped[ %s ]", err)
+	}()
+}
+
+// injectLiveReload adds the live-reload script to HTML responses.
+func injectLiveReload(resp *http.Response) error {
+	mediatype, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediatype != "text/html" {
+		return nil
+	}
+	if enc := resp.Header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if i := bytes.LastIndex(bytes.ToLower(body), []byte("</body>")); i >= 0 {
+		body = append(body[:i:i], append(liveReloadTag, body[i:]...)...)
+	} else {
+		body = append(body, liveReloadTag...)
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppGate(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	errDown := errors.New("the app exited: exit code 1")
+	var cases = []struct {
+		name string
+		// before changes the gate before the wait, during while it waits
+		before []func(g *appGate)
+		during func(g *appGate)
+		cancel bool
+		want   string // the wait error, empty for none
+	}{
+		{"shut", nil, nil, false, "the app is not up after 50ms"},
+		{"open", []func(*appGate){(*appGate).open}, nil, false, ""},
+		{"opened while waiting", nil, (*appGate).open, false, ""},
+		{"reopened", []func(*appGate){(*appGate).open, (*appGate).shut}, (*appGate).open, false, ""},
+		{"shut again", []func(*appGate){(*appGate).open, (*appGate).shut}, nil, false, "the app is not up after 50ms"},
+		{"failed", []func(*appGate){func(g *appGate) { g.fail(errDown) }}, nil, false, errDown.Error()},
+		{"failed while waiting", nil, func(g *appGate) { g.fail(errDown) }, false, errDown.Error()},
+		{"shut after failing", []func(*appGate){func(g *appGate) { g.fail(errDown) }, (*appGate).shut}, nil, false, "the app is not up after 50ms"},
+		{"opened after failing", []func(*appGate){func(g *appGate) { g.fail(errDown) }, (*appGate).shut, (*appGate).open}, nil, false, ""},
+		{"canceled", nil, nil, true, context.Canceled.Error()},
+	}
+	for _, c := range cases {
+		g := &appGate{up: make(chan struct{})}
+		for _, step := range c.before {
+			step(g)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		if c.during != nil || c.cancel {
+			go func(during func(*appGate), cancelIt bool) {
+				time.Sleep(timeout / 5)
+				if during != nil {
+					during(g)
+				}
+				if cancelIt {
+					cancel()
+				}
+			}(c.during, c.cancel)
+		}
+		err := g.wait(ctx, timeout)
+		cancel()
+		var got string
+		if err != nil {
+			got = err.Error()
+		}
+		if got != c.want {
+			t.Errorf("%s: got error %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestInjectLiveReload(t *testing.T) {
+	tag := string(liveReloadTag)
+	var cases = []struct {
+		contentType string
+		encoding    string
+		body        string
+		want        string
+	}{
+		{"text/html; charset=utf-8", "", "<html><body>hi</body></html>", "<html><body>hi" + tag + "</body></html>"},
+		{"text/html", "", "<BODY>a</BODY><!-- </body> -->", "<BODY>a</BODY><!-- " + tag + "</body> -->"},
+		{"text/html", "identity", "<p>no body</p>", "<p>no body</p>" + tag},
+		{"text/html", "gzip", "<body></body>", "<body></body>"},
+		{"application/json", "", `{"body": "</body>"}`, `{"body": "</body>"}`},
+		{"", "", "<body></body>", "<body></body>"},
+	}
+	for i, c := range cases {
+		resp := &http.Response{
+			Header:        make(http.Header),
+			Body:          ioutil.NopCloser(strings.NewReader(c.body)),
+			ContentLength: int64(len(c.body)),
+		}
+		resp.Header.Set("Content-Type", c.contentType)
+		if c.encoding != "" {
+			resp.Header.Set("Content-Encoding", c.encoding)
+		}
+		if err := injectLiveReload(resp); err != nil {
+			t.Errorf("case %d: %v", i, err)
+			continue
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		if string(body) != c.want {
+			t.Errorf("case %d: got body %q, want %q", i, body, c.want)
+		}
+		if resp.ContentLength != int64(len(c.want)) {
+			t.Errorf("case %d: got content length %d, want %d", i, resp.ContentLength, len(c.want))
+		}
+		if c.want != c.body && resp.Header.Get("Content-Length") != strconv.Itoa(len(c.want)) {
+			t.Errorf("case %d: got Content-Length %q, want %d", i, resp.Header.Get("Content-Length"), len(c.want))
+		}
+	}
+}
+
+func TestIsConnRefused(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	_, dialErr := net.Dial("tcp", addr)
+	var cases = []struct {
+		err  error
+		want bool
+	}{
+		{dialErr, true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", errConnRefused)}, true},
+		{errors.New("connection refused"), false},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("i/o timeout")}, false},
+		{nil, false},
+	}
+	for i, c := range cases {
+		if got := isConnRefused(c.err); got != c.want {
+			t.Errorf("case %d: isConnRefused(%v) = %v, want %v", i, c.err, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// errNotReady is returned when the readiness checks time out while the app is still running.
+var errNotReady = errors.New("not ready")
+
+// waitReady blocks until all the readiness checks pass, the app exits or the timeout expires.
+// The polling checks stop when it returns.
+func waitReady(p *appProcess) error {
+	rc := &cfg.Run.Ready
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var checks []<-chan struct{}
+	if rc.TCP != "" {
+		dialer := &net.Dialer{Timeout: time.Second}
+		checks = append(checks, poll(ctx, func() bool {
+			conn, err := dialer.DialContext(ctx, "tcp", rc.TCP)
+			if err != nil {
+				return false
+			}
+			conn.Close()
+			return true
+		}))
+	}
+	if rc.HTTP != "" {
+		client := &http.Client{
+			Timeout: 2 * time.Second,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		checks = append(checks, poll(ctx, func() bool {
+			req, err := http.NewRequest("GET", rc.HTTP, nil)
+			if err != nil {
+				return false
+			}
+			resp, err := client.Do(req.WithContext(ctx))
+			if err != nil {
+				return false
+			}
+			resp.Body.Close()
+			return resp.StatusCode < 400
+		}))
+	}
+	if p.logMatcher != nil {
+		checks = append(checks, p.logMatcher.matched)
+	}
+
+	timeout := time.NewTimer(rc.timeout)
+	defer timeout.Stop()
+	for _, check := range checks {
+		select {
+		case <-check:
+		case <-p.done:
+			return fmt.Errorf("the app exited before it was ready: %s", exitStatus(p.err))
+		case <-timeout.C:
+			return errNotReady
+		}
+	}
+	// the process may have exited on its own right after the checks
+	select {
+	case <-p.done:
+		return fmt.Errorf("the app exited: %s", exitStatus(p.err))
+	default:
+		return nil
+	}
+}
+
+// poll calls check periodically until it returns true or the context is done.
+// The returned channel is closed on success.
+func poll(ctx context.Context, check func() bool) <-chan struct{} {
+	ok := make(chan struct{})
+	go func() {
+		for !check() {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+		close(ok)
+	}()
+	return ok
+}
+
+// logMatcher closes matched at the first output line that matches the regexp.
+type logMatcher struct {
+	re      *regexp.Regexp
+	mu      sync.Mutex
+	line    []byte
+	matched chan struct{}
+	done    bool
+}
+
+func newLogMatcher(re *regexp.Regexp) *logMatcher {
+	return &logMatcher{re: re, matched: make(chan struct{})}
+}
+
+// Write implements io.Writer, it is safe for the stdout and stderr copiers.
+func (m *logMatcher) Write(b []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.done {
+		return len(b), nil
+	}
+	m.line = append(m.line, b...)
+	for {
+		i := bytes.IndexByte(m.line, '\n')
+		if i < 0 {
+			break
+		}
+		if m.re.Match(m.line[:i]) {
+			m.done = true
+			m.line = nil
+			close(m.matched)
+			return len(b), nil
+		}
+		m.line = m.line[i+1:]
+	}
+	// a single line never holds more than 64KB
+	if len(m.line) > 64<<10 {
+		m.line = m.line[len(m.line)-64<<10:]
+	}
+	return len(b), nil
+}
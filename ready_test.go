@@ -0,0 +1,63 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoll(t *testing.T) {
+	var cases = []struct {
+		name   string
+		passAt int32 // the call which passes, 0 for none
+		cancel bool
+		want   bool
+	}{
+		{"passes at once", 1, false, true},
+		{"passes later", 3, false, true},
+		{"canceled", 0, true, false},
+	}
+	for _, c := range cases {
+		var calls int32
+		passAt := c.passAt
+		ctx, cancel := context.WithCancel(context.Background())
+		ok := poll(ctx, func() bool {
+			n := atomic.AddInt32(&calls, 1)
+			return passAt > 0 && n >= passAt
+		})
+		if c.cancel {
+			time.AfterFunc(250*time.Millisecond, cancel)
+		}
+		var got bool
+		select {
+		case <-ok:
+			got = true
+		case <-time.After(time.Second):
+		}
+		cancel()
+		if got != c.want {
+			t.Errorf("%s: got passed %v, want %v", c.name, got, c.want)
+		}
+		// the check is not called any more once it passed or was canceled
+		n := atomic.LoadInt32(&calls)
+		time.Sleep(300 * time.Millisecond)
+		if m := atomic.LoadInt32(&calls); m != n {
+			t.Errorf("%s: the check was called %d more times after polling stopped", c.name, m-n)
+		}
+	}
+}
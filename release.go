@@ -0,0 +1,212 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/henrylee2cn/faygo"
+)
+
+// releaseFlags are the options of `fay build`.
+type releaseFlags struct {
+	set                                       *flag.FlagSet
+	config, targets, output, version, ldflags string
+}
+
+func newReleaseFlags(name string, usage func()) *releaseFlags {
+	f := &releaseFlags{set: flag.NewFlagSet(name, flag.ExitOnError)}
+	f.set.Usage = usage
+	f.set.StringVar(&f.config, "config", "", "config file")
+	f.set.StringVar(&f.targets, "targets", "", "GOOS/GOARCH targets")
+	f.set.StringVar(&f.output, "o", "", "output directory")
+	f.set.StringVar(&f.version, "version", "", "version of the release")
+	f.set.StringVar(&f.ldflags, "ldflags", "", "extra linker flags")
+	return f
+}
+
+// apply overrides the release config with the options that were set.
+func (f *releaseFlags) apply(c *fayConfig) {
+	f.set.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "targets":
+			c.Release.Targets = splitList(f.targets)
+		case "o":
+			c.Release.Output = f.output
+		case "version":
+			c.Release.Version = f.version
+		case "ldflags":
+			c.Release.Ldflags = strings.Fields(f.ldflags)
+		}
+	})
+}
+
+func buildapp(args []string) {
+	flags := newReleaseFlags("build", buildappHelp)
+	args = parseInterspersed(flags.set, args)
+	switch len(args) {
+	case 0, 1:
+		initVar(args)
+	default:
+		buildappHelp()
+		return
+	}
+	if err := os.Chdir(curpath); err != nil {
+		faygo.Fatalf("[fay] Build project fail: %v", err)
+	}
+	setupConfig(flags.config, flags.apply)
+	r, err := newRelease()
+	if err != nil {
+		faygo.Fatalf("[fay] Build project fail: %v", err)
+	}
+	if err = os.MkdirAll(cfg.Release.Output, 0777); err != nil {
+		faygo.Fatalf("[fay] Build project fail: %v", err)
+	}
+	var artifacts []string
+	for _, target := range cfg.Release.Targets {
+		artifact, err := r.build(target, "")
+		if err != nil {
+			faygo.Fatalf("[fay] ============== Build %s failed ===================\n%v", target, err)
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	sums, err := writeChecksums(filepath.Join(cfg.Release.Output, "SHA256SUMS"), artifacts)
+	if err != nil {
+		faygo.Fatalf("[fay] Build project fail: %v", err)
+	}
+	faygo.Printf("[fay] Checksums: %s", sums)
+	faygo.Printf("[fay] Build %s %s was successful", appname, r.version)
+}
+
+// release builds the artifacts of one version.
+type release struct {
+	project *goProject
+	version string
+	commit  string
+	time    string
+}
+
+func newRelease() (*release, error) {
+	project, err := detectGoProject(curpath)
+	if err != nil {
+		return nil, err
+	}
+	r := &release{
+		project: project,
+		version: cfg.Release.Version,
+		commit:  gitOutput("rev-parse", "--short", "HEAD"),
+		time:    time.Now().UTC().Format(time.RFC3339),
+	}
+	if r.version == "" {
+		r.version = gitOutput("describe", "--tags", "--always", "--dirty")
+	}
+	if r.version == "" {
+		r.version = "dev"
+	}
+	return r, nil
+}
+
+// build cross-compiles the app for the GOOS/GOARCH target into filename,
+// with the flags and the packages of the go build command of the config.
+// If filename is empty, the artifact is `<output>/<appname>_<goos>_<goarch>`.
+func (r *release) build(target, filename string) (string, error) {
+	goos, goarch, err := parseTarget(target)
+	if err != nil {
+		return "", err
+	}
+	if filename == "" {
+		filename = filepath.Join(cfg.Release.Output, fmt.Sprintf("%s_%s_%s", appname, goos, goarch))
+		if goos == "windows" {
+			filename += ".exe"
+		}
+	}
+	filename, err = filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	ldflags := []string{
+		"-X", cfg.Release.VersionVar + "=" + r.version,
+		"-X", cfg.Release.CommitVar + "=" + r.commit,
+		"-X", cfg.Release.TimeVar + "=" + r.time,
+	}
+	ldflags = append(ldflags, cfg.Release.Ldflags...)
+	args := []string{"build", "-trimpath", "-ldflags", strings.Join(ldflags, " "), "-o", filename}
+	args = append(args, cfg.Build.Flags...)
+	// the packages of the go build command, e.g. `./cmd/myapp`
+	args = append(args, cfg.releaseArgs()...)
+	faygo.Printf("[fay] Build %s: go %s", target, strings.Join(args, " "))
+	cmd := exec.Command("go", args...)
+	cmd.Dir = r.project.dir
+	// CGO is disabled for the cross-compilation, unless it is configured.
+	env := append(os.Environ(), "CGO_ENABLED=0")
+	if v, ok := os.LookupEnv("CGO_ENABLED"); ok {
+		env = append(env, "CGO_ENABLED="+v)
+	}
+	env = append(env, "GOOS="+goos, "GOARCH="+goarch)
+	cmd.Env = cfg.environ(r.project.env(env))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err = cmd.Run(); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+// parseTarget parses `goos/goarch`.
+func parseTarget(target string) (goos, goarch string, err error) {
+	a := strings.Split(target, "/")
+	if len(a) != 2 || a[0] == "" || a[1] == "" {
+		return "", "", fmt.Errorf("invalid target %q, it must be GOOS/GOARCH", target)
+	}
+	return a[0], a[1], nil
+}
+
+// gitOutput returns the trimmed output of the git command, or empty on failure.
+func gitOutput(args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = curpath
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// writeChecksums writes the SHA-256 of the files in the sha256sum format.
+func writeChecksums(filename string, files []string) (string, error) {
+	var buf bytes.Buffer
+	for _, file := range files {
+		sum, err := sha256File(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&buf, "%s  %s\n", sum, filepath.Base(file))
+	}
+	return filename, ioutil.WriteFile(filename, buf.Bytes(), 0666)
+}
+
+// hostTarget returns the GOOS/GOARCH of fay.
+func hostTarget() string {
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReleaseArgs(t *testing.T) {
+	var cases = []struct {
+		cmd  string
+		want []string
+	}{
+		{"go build", []string{}},
+		{"go build ./cmd/myapp", []string{"./cmd/myapp"}},
+		{"go build -tags dev ./cmd/myapp", []string{"-tags", "dev", "./cmd/myapp"}},
+		{"/usr/local/go/bin/go build .", []string{"."}},
+		{"go", nil},
+		{"make build", nil},
+		{"./build.sh ./cmd/myapp", nil},
+	}
+	for _, c := range cases {
+		conf := &fayConfig{}
+		conf.Build.Cmd = c.cmd
+		if got := conf.releaseArgs(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: got %q, want %q", c.cmd, got, c.want)
+		}
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	var cases = []struct {
+		target       string
+		goos, goarch string
+		err          bool
+	}{
+		{"linux/amd64", "linux", "amd64", false},
+		{"windows/386", "windows", "386", false},
+		{"linux", "", "", true},
+		{"linux/", "", "", true},
+		{"/amd64", "", "", true},
+		{"linux/arm/v7", "", "", true},
+	}
+	for _, c := range cases {
+		goos, goarch, err := parseTarget(c.target)
+		if (err != nil) != c.err || goos != c.goos || goarch != c.goarch {
+			t.Errorf("%q: got %q, %q, %v", c.target, goos, goarch, err)
+		}
+	}
+}
+
+func TestWriteChecksums(t *testing.T) {
+	root, err := ioutil.TempDir("", "fay-release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	var files []string
+	for name, content := range map[string]string{
+		"myapp_linux_amd64":       "abc",
+		"myapp_windows_amd64.exe": "",
+	} {
+		name = filepath.Join(root, "dist", name)
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, name)
+	}
+	if files[0] > files[1] {
+		files[0], files[1] = files[1], files[0]
+	}
+	filename := filepath.Join(root, "dist", "SHA256SUMS")
+	got, err := writeChecksums(filename, files)
+	if err != nil || got != filename {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the sha256sum format, with the base names of the artifacts
+	want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad  myapp_linux_amd64\n" +
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  myapp_windows_amd64.exe\n"
+	if string(b) != want {
+		t.Errorf("got checksums\n%s\nwant\n%s", b, want)
+	}
+	// a missing artifact is an error
+	if _, err = writeChecksums(filename, append(files, filepath.Join(root, "missing"))); err == nil {
+		t.Error("got no error for a missing file")
+	}
+}
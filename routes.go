@@ -0,0 +1,64 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/henrylee2cn/fay/generator"
+	"github.com/henrylee2cn/faygo"
+)
+
+// routesapp prints the routes of the project's router trees.
+func routesapp(args []string) {
+	set := flag.NewFlagSet("routes", flag.ExitOnError)
+	set.Usage = routesappHelp
+	asJSON := set.Bool("json", false, "print the routes in JSON")
+	args = parseInterspersed(set, args)
+	switch len(args) {
+	case 0, 1:
+		initVar(args)
+	default:
+		routesappHelp()
+		return
+	}
+	routes, err := generator.ParseRoutes(curpath)
+	if err != nil {
+		faygo.Fatalf("[fay] Parse routes fail: %v", err)
+	}
+	if *asJSON {
+		b, err := json.MarshalIndent(routes, "", "  ")
+		if err != nil {
+			faygo.Fatalf("[fay] Parse routes fail: %v", err)
+		}
+		fmt.Println(string(b))
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "METHOD\tPATH\tHANDLER\tMIDDLEWARES\tLOCATION")
+	for _, r := range routes {
+		middlewares := strings.Join(r.Middlewares, " -> ")
+		if middlewares == "" {
+			middlewares = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s:%d\n", r.Method, r.Path, r.Handler, middlewares, r.File, r.Line)
+	}
+	w.Flush()
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// scheduler calls the change handler from a single goroutine:
+// the changes are coalesced until there is no change for the delay,
+// at most one batch of files is pending while the handler runs,
+// and a new change cancels the running handler through its context.
+type scheduler struct {
+	delay   time.Duration
+	run     func(ctx context.Context, files []string) error
+	changes chan string
+}
+
+// newScheduler starts a scheduler, the handler returns the error of
+// the context if it was canceled before taking effect, so that its
+// files are handled again with the new ones.
+func newScheduler(delay time.Duration, run func(ctx context.Context, files []string) error) *scheduler {
+	s := &scheduler{
+		delay:   delay,
+		run:     run,
+		changes: make(chan string, 64),
+	}
+	go s.loop()
+	return s
+}
+
+// add schedules the changed file.
+func (s *scheduler) add(name string) {
+	s.changes <- name
+}
+
+func (s *scheduler) loop() {
+	var (
+		pending = make(map[string]bool)
+		running []string           // files of the running handler
+		done    chan error         // nil while no handler runs
+		cancel  context.CancelFunc // cancels the running handler
+		waiting bool               // the timer is active
+	)
+	timer := time.NewTimer(s.delay)
+	timer.Stop()
+	start := func() {
+		running = make([]string, 0, len(pending))
+		for name := range pending {
+			running = append(running, name)
+		}
+		sort.Strings(running)
+		pending = make(map[string]bool)
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		done = make(chan error, 1)
+		go func(ctx context.Context, files []string, done chan<- error) {
+			done <- s.run(ctx, files)
+		}(ctx, running, done)
+	}
+	for {
+		select {
+		case name := <-s.changes:
+			pending[name] = true
+			if waiting && !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(s.delay)
+			waiting = true
+			if cancel != nil {
+				cancel()
+			}
+		case <-timer.C:
+			waiting = false
+			if done == nil && len(pending) > 0 {
+				start()
+			}
+		case err := <-done:
+			if err == context.Canceled {
+				for _, name := range running {
+					pending[name] = true
+				}
+			}
+			cancel()
+			running, done, cancel = nil, nil, nil
+			if !waiting && len(pending) > 0 {
+				start()
+			}
+		}
+	}
+}
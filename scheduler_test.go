@@ -0,0 +1,93 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	// the gaps are far from the delay, so that a slow machine keeps the order
+	const delay = 200 * time.Millisecond
+	var cases = []struct {
+		name string
+		// batches of changes, the batches are gap apart
+		batches [][]string
+		gap     time.Duration
+		// first is the behaviour of the first run: "return" at once, "cancel"
+		// waits to be canceled, "slow" ignores the context for a while
+		first string
+		want  [][]string
+	}{
+		{"debounce", [][]string{{"b", "a", "b", "c"}}, 0, "return", [][]string{{"a", "b", "c"}}},
+		{"debounce across batches", [][]string{{"a"}, {"b"}}, delay / 10, "return", [][]string{{"a", "b"}}},
+		{"separate batches", [][]string{{"a"}, {"b"}}, 5 * delay, "return", [][]string{{"a"}, {"b"}}},
+		{"cancel and re-queue", [][]string{{"a"}, {"b"}}, 3 * delay, "cancel", [][]string{{"a"}, {"a", "b"}}},
+		{"pending while running", [][]string{{"a"}, {"b"}}, 3 * delay, "slow", [][]string{{"a"}, {"b"}}},
+	}
+	for _, c := range cases {
+		c := c
+		// the cases take a few delays each, run them in parallel
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			runs := make(chan []string, 10)
+			var calls int
+			s := newScheduler(delay, func(ctx context.Context, files []string) error {
+				calls++
+				runs <- files
+				if calls > 1 {
+					return nil
+				}
+				switch c.first {
+				case "cancel":
+					<-ctx.Done()
+					return ctx.Err()
+				case "slow":
+					time.Sleep(5 * delay)
+				}
+				return nil
+			})
+			for i, batch := range c.batches {
+				if i > 0 {
+					time.Sleep(c.gap)
+				}
+				for _, name := range batch {
+					s.add(name)
+				}
+			}
+			var got [][]string
+			timeout := time.After(20 * delay)
+		collect:
+			for {
+				// wait for the wanted runs, and then a while for unwanted ones
+				if len(got) == len(c.want) {
+					timeout = time.After(3 * delay)
+				}
+				select {
+				case files := <-runs:
+					got = append(got, files)
+				case <-timeout:
+					break collect
+				}
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got runs %q, want %q", got, c.want)
+			}
+		})
+	}
+}
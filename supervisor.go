@@ -0,0 +1,495 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/faygo"
+)
+
+// restart policies of the app and the processes
+const (
+	restartNever     = "never"
+	restartOnFailure = "on-failure"
+	restartAlways    = "always"
+)
+
+const (
+	// maxRestartDelay caps the doubled delay before restarting
+	maxRestartDelay = 30 * time.Second
+	// stableTime is the run time after which a crash no longer counts
+	// as a crash loop, so the delay and the count start over
+	stableTime = 30 * time.Second
+)
+
+func validRestart(policy string) bool {
+	return policy == restartNever || policy == restartOnFailure || policy == restartAlways
+}
+
+// procNameRegexp matches the valid process names.
+var procNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// initProcesses reads the Procfile, completes its processes with the
+// configured ones of the same name, and checks them.
+func (c *fayConfig) initProcesses(appname string) error {
+	procfile := c.Procfile
+	if procfile == "" && isFile(filepath.Join(c.dir, "Procfile")) {
+		procfile = "Procfile"
+	}
+	var list []processConfig
+	if procfile != "" {
+		if !filepath.IsAbs(procfile) {
+			procfile = filepath.Join(c.dir, procfile)
+		}
+		data, err := ioutil.ReadFile(procfile)
+		if err != nil {
+			return fmt.Errorf("procfile: %v", err)
+		}
+		if list, err = parseProcfile(string(data)); err != nil {
+			return fmt.Errorf("%s: %v", procfile, err)
+		}
+	}
+	for _, pc := range c.Processes {
+		var found bool
+		for i := range list {
+			if list[i].Name != pc.Name {
+				continue
+			}
+			found = true
+			// only the set values override the Procfile
+			if pc.Cmd != "" {
+				list[i].Cmd = pc.Cmd
+			}
+			if pc.Build != "" {
+				list[i].Build = pc.Build
+			}
+			if pc.Dir != "" {
+				list[i].Dir = pc.Dir
+			}
+			if pc.Watch != nil {
+				list[i].Watch = pc.Watch
+			}
+			if pc.Restart != "" {
+				list[i].Restart = pc.Restart
+			}
+		}
+		if !found {
+			list = append(list, pc)
+		}
+	}
+	names := map[string]bool{appname: true}
+	for i := range list {
+		pc := &list[i]
+		if !procNameRegexp.MatchString(pc.Name) {
+			return fmt.Errorf("processes: invalid name %q", pc.Name)
+		}
+		if names[pc.Name] {
+			return fmt.Errorf("processes: duplicate name %q, the app is %q", pc.Name, appname)
+		}
+		names[pc.Name] = true
+		if strings.TrimSpace(pc.Cmd) == "" {
+			return fmt.Errorf("processes: %s: no cmd", pc.Name)
+		}
+		if pc.Restart == "" {
+			pc.Restart = restartNever
+		}
+		if !validRestart(pc.Restart) {
+			return fmt.Errorf("processes: %s: invalid restart %q, use never, on-failure or always", pc.Name, pc.Restart)
+		}
+	}
+	c.Processes = list
+	return nil
+}
+
+// parseProcfile parses the `name: command` lines of a Procfile.
+func parseProcfile(content string) ([]processConfig, error) {
+	var list []processConfig
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			return nil, fmt.Errorf("line %d: want `name: command`", i+1)
+		}
+		list = append(list, processConfig{
+			Name: strings.TrimSpace(line[:colon]),
+			Cmd:  strings.TrimSpace(line[colon+1:]),
+		})
+	}
+	return list, nil
+}
+
+var (
+	mainApp *proc   // the app built and run by the build and run settings
+	procs   []*proc // the processes supervised next to the app
+)
+
+// proc is a supervised process, it runs one appProcess at a time.
+type proc struct {
+	name    string
+	args    []string // command of the app
+	shell   string   // shell command line of the other processes
+	build   string   // shell command line of the build
+	dir     string
+	watch   []string
+	restart string
+	stdout  io.Writer
+	stderr  io.Writer
+	runLock sync.Mutex // serializes the builds and the restarts of the other processes
+	lock    sync.Mutex
+	current *appProcess
+	crashes int // automatic restarts in a row
+}
+
+// newProcs creates the app and the configured processes. With the
+// processes, the output lines are prefixed with the names.
+func newProcs() {
+	mainApp = &proc{
+		name:    appname,
+		args:    cfg.runArgs(),
+		dir:     curpath,
+		restart: cfg.Run.Restart,
+		stdout:  os.Stdout,
+		stderr:  os.Stderr,
+	}
+	procs = nil
+	if len(cfg.Processes) == 0 {
+		return
+	}
+	width := len(appname)
+	for _, pc := range cfg.Processes {
+		if len(pc.Name) > width {
+			width = len(pc.Name)
+		}
+	}
+	color := isTerminal(os.Stdout)
+	out := &syncWriter{w: os.Stdout}
+	prefix := func(i int, name string) io.Writer {
+		p := fmt.Sprintf("%-*s | ", width, name)
+		if color {
+			p = fmt.Sprintf("\x1b[%dm%s\x1b[0m", procColors[i%len(procColors)], p)
+		}
+		return &prefixWriter{prefix: p, w: out}
+	}
+	mainApp.stdout = prefix(0, appname)
+	mainApp.stderr = mainApp.stdout
+	for i, pc := range cfg.Processes {
+		pr := &proc{
+			name:    pc.Name,
+			shell:   pc.Cmd,
+			build:   pc.Build,
+			dir:     filepath.Join(curpath, pc.Dir),
+			watch:   pc.Watch,
+			restart: pc.Restart,
+			stdout:  prefix(i+1, pc.Name),
+		}
+		pr.stderr = pr.stdout
+		procs = append(procs, pr)
+	}
+}
+
+// procColors are the ANSI colors of the prefixes.
+var procColors = []int{36, 33, 32, 35, 34, 31}
+
+// running returns the running process, or nil.
+func (pr *proc) running() *appProcess {
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+	return pr.current
+}
+
+func (pr *proc) setRunning(p *appProcess) {
+	pr.lock.Lock()
+	pr.current = p
+	pr.lock.Unlock()
+}
+
+// watches returns whether any of the files is in the watch scope of the process.
+func (pr *proc) watches(files []string) bool {
+	for _, name := range files {
+		if matchSelfOrParent(pr.watch, relPath(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// startProcs builds and starts the processes next to the app.
+func startProcs() {
+	for _, pr := range procs {
+		pr.rebuild(context.Background())
+	}
+}
+
+// rebuild builds the process if it has a build command, and restarts it.
+// It returns the error of the context if the build is canceled.
+func (pr *proc) rebuild(ctx context.Context) error {
+	pr.runLock.Lock()
+	defer pr.runLock.Unlock()
+	pr.resetCrashes()
+	if pr.build != "" {
+		faygo.Printf("[fay] Build %s: %s", pr.name, pr.build)
+		cmd := shellCommand(pr.build)
+		cmd.Dir = pr.dir
+		cmd.Env = cfg.environ(os.Environ())
+		cmd.Stdout = pr.stdout
+		cmd.Stderr = pr.stderr
+		err := runGroup(ctx, cmd)
+		if ctx.Err() != nil {
+			faygo.Printf("[fay] Build of %s canceled by new changes", pr.name)
+			return ctx.Err()
+		}
+		if err != nil {
+			faygo.Errorf("[fay] ============== Build of %s failed ===================", pr.name)
+			return nil
+		}
+	}
+	pr.restartLocked()
+	return nil
+}
+
+// runGroup runs the command in a new process group, and kills the group when
+// the context is done, since killing the shell would leave its children running.
+func runGroup(ctx context.Context, cmd *exec.Cmd) error {
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			killGroup(cmd)
+		case <-done:
+		}
+	}()
+	return cmd.Wait()
+}
+
+// restartLocked stops the running process and starts the new one.
+func (pr *proc) restartLocked() {
+	if p := pr.running(); p != nil {
+		p.stop()
+	}
+	p, err := pr.start(nil)
+	if err != nil {
+		faygo.Errorf("[fay] Fail to start %s[ %s ]", pr.name, err)
+		return
+	}
+	pr.setRunning(p)
+	faygo.Printf("[fay] Started %s", pr.name)
+}
+
+// exited handles the exit of the process by itself, and restarts it
+// after a delay according to its restart policy.
+func (pr *proc) exited(p *appProcess) {
+	status := exitStatus(p.err)
+	if pr == mainApp {
+		gate.shut()
+		faygo.Warningf("[fay] App exited by itself: %s", status)
+	} else {
+		faygo.Warningf("[fay] Process %s exited by itself: %s", pr.name, status)
+	}
+	if pr.restart == restartNever || (pr.restart == restartOnFailure && p.err == nil) {
+		if pr == mainApp {
+			gate.fail(fmt.Errorf("the app exited: %s", status))
+		}
+		return
+	}
+	delay, ok := pr.backoff(time.Since(p.started))
+	if !ok {
+		faygo.Errorf("[fay] %s is crash looping, %d restarts in a row failed, give up until the next change. The last output lines:\n%s",
+			pr.name, cfg.Run.MaxRestarts, p.tail)
+		if pr == mainApp {
+			gate.fail(fmt.Errorf("the app is crash looping: %s", status))
+		}
+		return
+	}
+	faygo.Printf("[fay] Restart %s in %v", pr.name, delay)
+	go func() {
+		time.Sleep(delay)
+		if pr == mainApp {
+			state.Lock()
+			defer state.Unlock()
+		} else {
+			pr.runLock.Lock()
+			defer pr.runLock.Unlock()
+		}
+		// a change may have restarted it meanwhile
+		if pr.running() != p {
+			return
+		}
+		if pr == mainApp {
+			Restart()
+		} else {
+			pr.restartLocked()
+		}
+	}()
+}
+
+// backoff returns the delay before the next automatic restart, doubled after
+// each crash, or false after too many crashes in a row. A process that ran
+// for stableTime is not crash looping, so the count starts over.
+func (pr *proc) backoff(ran time.Duration) (time.Duration, bool) {
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+	if ran >= stableTime {
+		pr.crashes = 0
+	}
+	if pr.crashes >= cfg.Run.MaxRestarts {
+		return 0, false
+	}
+	delay := cfg.Run.restartDelay
+	for i := 0; i < pr.crashes && delay < maxRestartDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRestartDelay {
+		delay = maxRestartDelay
+	}
+	pr.crashes++
+	return delay, true
+}
+
+// resetCrashes starts the count of the crashes over, e.g. after a change.
+func (pr *proc) resetCrashes() {
+	pr.lock.Lock()
+	pr.crashes = 0
+	pr.lock.Unlock()
+}
+
+// stopAll stops the app and the processes.
+func stopAll() {
+	var wg sync.WaitGroup
+	for _, pr := range append([]*proc{mainApp}, procs...) {
+		if pr == nil {
+			continue
+		}
+		if p := pr.running(); p != nil {
+			wg.Add(1)
+			go func(p *appProcess) {
+				defer wg.Done()
+				p.stop()
+			}(p)
+		}
+	}
+	wg.Wait()
+}
+
+// syncWriter serializes the writes of the processes, so that the lines do not interleave.
+type syncWriter struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func (s *syncWriter) Write(b []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.w.Write(b)
+}
+
+// prefixWriter writes the complete lines with the prefix.
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+	lock   sync.Mutex
+	line   []byte
+}
+
+// Write implements io.Writer, it is safe for the stdout and stderr copiers.
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.line = append(p.line, b...)
+	var buf bytes.Buffer
+	for {
+		i := bytes.IndexByte(p.line, '\n')
+		// a line longer than 64KB is written in pieces
+		if i < 0 && len(p.line) > 64<<10 {
+			i = len(p.line) - 1
+		}
+		if i < 0 {
+			break
+		}
+		buf.WriteString(p.prefix)
+		buf.Write(p.line[:i+1])
+		if p.line[i] != '\n' {
+			buf.WriteByte('\n')
+		}
+		p.line = p.line[i+1:]
+	}
+	if buf.Len() > 0 {
+		if _, err := p.w.Write(buf.Bytes()); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// tailWriter keeps the last lines of the output.
+type tailWriter struct {
+	lock  sync.Mutex
+	max   int
+	lines [][]byte
+	line  []byte
+}
+
+func newTailWriter(max int) *tailWriter {
+	return &tailWriter{max: max}
+}
+
+// Write implements io.Writer, it is safe for the stdout and stderr copiers.
+func (t *tailWriter) Write(b []byte) (int, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.line = append(t.line, b...)
+	for {
+		i := bytes.IndexByte(t.line, '\n')
+		if i < 0 {
+			break
+		}
+		t.lines = append(t.lines, append([]byte(nil), t.line[:i+1]...))
+		t.line = t.line[i+1:]
+	}
+	if len(t.lines) > t.max {
+		t.lines = append(t.lines[:0], t.lines[len(t.lines)-t.max:]...)
+	}
+	// a single line never holds more than 64KB
+	if len(t.line) > 64<<10 {
+		t.line = t.line[len(t.line)-64<<10:]
+	}
+	return len(b), nil
+}
+
+// String returns the last lines, with the incomplete last line.
+func (t *tailWriter) String() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return string(bytes.Join(t.lines, nil)) + string(t.line)
+}
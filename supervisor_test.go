@@ -0,0 +1,167 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	defer func(c *fayConfig) { cfg = c }(cfg)
+	// a zero delay stands for giving up
+	var cases = []struct {
+		name        string
+		delay       time.Duration
+		maxRestarts int
+		ran         []time.Duration // run time of each crash
+		want        []time.Duration
+	}{
+		{"crash loop", time.Second, 3, []time.Duration{0, 0, 0, 0, 0}, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 0, 0}},
+		{"stable run starts over", time.Second, 3, []time.Duration{0, 0, stableTime, 0}, []time.Duration{time.Second, 2 * time.Second, time.Second, 2 * time.Second}},
+		{"short run counts", time.Second, 3, []time.Duration{0, stableTime - time.Second, 0, 0}, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 0}},
+		{"stable run after giving up", time.Second, 1, []time.Duration{0, 0, stableTime}, []time.Duration{time.Second, 0, time.Second}},
+		{"capped delay", 10 * time.Second, 10, []time.Duration{0, 0, 0, 0}, []time.Duration{10 * time.Second, 20 * time.Second, maxRestartDelay, maxRestartDelay}},
+	}
+	for _, c := range cases {
+		cfg = &fayConfig{}
+		cfg.Run.restartDelay = c.delay
+		cfg.Run.MaxRestarts = c.maxRestarts
+		pr := &proc{name: "web"}
+		var got []time.Duration
+		for _, ran := range c.ran {
+			delay, ok := pr.backoff(ran)
+			if !ok {
+				delay = 0
+			}
+			got = append(got, delay)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got delays %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	// a change starts the count over
+	cfg = &fayConfig{}
+	cfg.Run.restartDelay = time.Second
+	cfg.Run.MaxRestarts = 1
+	pr := &proc{name: "web"}
+	pr.backoff(0)
+	if _, ok := pr.backoff(0); ok {
+		t.Errorf("the second crash in a row should give up")
+	}
+	pr.resetCrashes()
+	if delay, ok := pr.backoff(0); !ok || delay != time.Second {
+		t.Errorf("after resetCrashes: got %v %v, want 1s true", delay, ok)
+	}
+}
+
+func TestParseProcfile(t *testing.T) {
+	var cases = []struct {
+		content string
+		want    []processConfig
+		err     string
+	}{
+		{"", nil, ""},
+		{"web: ./web -port 80\n\n# comment\nworker:bundle exec sidekiq -c 5:10\n", []processConfig{
+			{Name: "web", Cmd: "./web -port 80"},
+			{Name: "worker", Cmd: "bundle exec sidekiq -c 5:10"},
+		}, ""},
+		{"web: ./web\nworker\n", nil, "line 2: want `name: command`"},
+	}
+	for i, c := range cases {
+		got, err := parseProcfile(c.content)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("case %d: got error %v, want %q", i, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("case %d: got %+v, want %+v", i, got, c.want)
+		}
+	}
+}
+
+func TestInitProcesses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fay-procfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "Procfile"), []byte("worker: ./worker\nmail: ./mail\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases = []struct {
+		name      string
+		processes []processConfig
+		want      []processConfig
+		err       string
+	}{
+		{"procfile", nil, []processConfig{
+			{Name: "worker", Cmd: "./worker", Restart: restartNever},
+			{Name: "mail", Cmd: "./mail", Restart: restartNever},
+		}, ""},
+		{"only the set values override", []processConfig{
+			{Name: "worker", Build: "go build -o worker ./cmd/worker", Watch: []string{"cmd/**"}, Restart: restartAlways},
+			{Name: "queue", Cmd: "./queue", Dir: "queue"},
+		}, []processConfig{
+			{Name: "worker", Cmd: "./worker", Build: "go build -o worker ./cmd/worker", Watch: []string{"cmd/**"}, Restart: restartAlways},
+			{Name: "mail", Cmd: "./mail", Restart: restartNever},
+			{Name: "queue", Cmd: "./queue", Dir: "queue", Restart: restartNever},
+		}, ""},
+		{"app name", []processConfig{{Name: "myapp", Cmd: "./other"}}, nil, `duplicate name "myapp"`},
+		{"invalid name", []processConfig{{Name: "a b", Cmd: "./ab"}}, nil, `invalid name "a b"`},
+		{"no cmd", []processConfig{{Name: "queue"}}, nil, "queue: no cmd"},
+		{"invalid restart", []processConfig{{Name: "mail", Restart: "sometimes"}}, nil, `invalid restart "sometimes"`},
+	}
+	for _, c := range cases {
+		conf := &fayConfig{dir: dir, Processes: c.processes}
+		err := conf.initProcesses("myapp")
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: got error %v, want %q", c.name, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(conf.Processes, c.want) {
+			t.Errorf("%s: got %+v, want %+v", c.name, conf.Processes, c.want)
+		}
+	}
+}
+
+func TestTailWriter(t *testing.T) {
+	tail := newTailWriter(2)
+	for _, s := range []string{"one\ntw", "o\nthree\n", "fou"} {
+		tail.Write([]byte(s))
+	}
+	if got, want := tail.String(), "two\nthree\nfou"; got != want {
+		t.Errorf("got tail %q, want %q", got, want)
+	}
+}
@@ -1,34 +1,48 @@
 package main
 
 import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"strings"
 )
 
-// askForConfirmation uses Scanln to parse user input. A user must type in "yes" or "no" and
+// stdin is shared by the questions, a reader per question may lose the buffered answers.
+var stdin = bufio.NewReader(os.Stdin)
+
+// askForConfirmation reads the user input line by line. A user must type in "yes" or "no" and
 // then press enter. It has fuzzy matching, so "y", "Y", "yes", "YES", and "Yes" all count as
-// confirmations. If the input is not recognized, it will ask again. The function does not return
-// until it gets a valid response from the user. Typically, you should use fmt to print out a question
+// confirmations. If the input is not recognized, it will ask again. At the end of the input,
+// e.g. `echo | fay new`, it returns false. Typically, you should use fmt to print out a question
 // before calling askForConfirmation. E.g. fmt.Println("WARNING: Are you sure? (yes/no)")
 func askForConfirmation() bool {
-	var response string
-	_, err := fmt.Scanln(&response)
-	if err != nil {
-		log.Fatal(err)
-	}
 	okayResponses := []string{"y", "Y", "yes", "Yes", "YES"}
 	nokayResponses := []string{"n", "N", "no", "No", "NO"}
-	if containsString(okayResponses, response) {
-		return true
-	} else if containsString(nokayResponses, response) {
-		return false
-	} else {
+	for {
+		line, err := stdin.ReadString('\n')
+		response := strings.TrimSpace(line)
+		if containsString(okayResponses, response) {
+			return true
+		} else if containsString(nokayResponses, response) {
+			return false
+		}
+		if err != nil {
+			fmt.Println()
+			return false
+		}
 		fmt.Println("Please type yes or no and then press enter:")
-		return askForConfirmation()
 	}
 }
 
+// isTerminal returns whether the file is a terminal, not a pipe or a regular file.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
 func containsString(slice []string, element string) bool {
 	for _, elem := range slice {
 		if elem == element {
@@ -43,3 +57,29 @@ func isExist(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil || os.IsExist(err)
 }
+
+// isFile returns whether path exists and is a regular file.
+func isFile(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && !fi.IsDir()
+}
+
+// isDir returns whether path exists and is a directory.
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+// sha256File returns the hex encoded SHA-256 of the file.
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
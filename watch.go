@@ -15,169 +15,298 @@
 package main
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
-	"runtime"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/henrylee2cn/fay/fsnotify"
 	"github.com/henrylee2cn/faygo"
 )
 
 var (
-	cmd          *exec.Cmd
 	state        sync.Mutex
-	eventTime    = make(map[string]int64)
-	scheduleTime time.Time
+	fileHashes   = make(map[string]string) // content hashes of the watched files
+	hashesLock   sync.Mutex
 	isFirstStart = true
 )
 
-func newWatcher() {
+// newWatcher watches the project directories, and calls onChange with the
+// changed files once there is no file change for the configured delay.
+// The context of onChange is canceled when new changes arrive meanwhile.
+// The directories created later are watched as well, and the removed ones are forgotten.
+// The returned function stops watching.
+func newWatcher(onChange func(ctx context.Context, files []string) error) (stop func()) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		faygo.Errorf("[fay] Fail to create new Watcher[ %s ]", err)
+		stopAll()
 		os.Exit(2)
 	}
+	dirs := &watchedDirs{Watcher: watcher, dirs: make(map[string]bool)}
 
+	schedule := newScheduler(cfg.Watch.delay, onChange).add
+
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
+		errs := watcher.Error
 		for {
 			select {
-			case e := <-watcher.Event:
+			case e, ok := <-watcher.Event:
+				if !ok {
+					return
+				}
 				isbuild := true
 
 				// Skip TMP files for Sublime Text.
 				if checkTMPFile(e.Name) {
 					continue
 				}
-				if !checkIfWatchExt(e.Name) {
+				if filepath.Base(e.Name) == ".gitignore" {
+					gitignored.forget(path.Dir(relPath(e.Name)))
+				}
+				if e.IsCreate() && isDir(e.Name) {
+					if !checkIfWatchedDir(e.Name) {
+						continue
+					}
+					// the files may be created before the directory is watched
+					for _, name := range dirs.add(e.Name) {
+						if checkFileChanged(name) {
+							faygo.Printf("[fay] %s: CREATE", name)
+							schedule(name)
+						}
+					}
+					continue
+				}
+				if (e.IsDelete() || e.IsRename()) && dirs.remove(e.Name) {
+					faygo.Printf("%s", e)
+					schedule(e.Name)
+					continue
+				}
+				if !checkIfWatched(e.Name) {
 					continue
 				}
 
-				mt := getFileModTime(e.Name)
-				if t := eventTime[e.Name]; mt == t {
+				if !checkFileChanged(e.Name) {
 					faygo.Printf("[fay] # %s #", e.String())
 					isbuild = false
 				}
 
-				eventTime[e.Name] = mt
-
 				if isbuild {
 					faygo.Printf("%s", e)
-					go func() {
-						// Wait 1s before autobuild util there is no file change.
-						scheduleTime = time.Now().Add(1 * time.Second)
-						for {
-							time.Sleep(scheduleTime.Sub(time.Now()))
-							if time.Now().After(scheduleTime) {
-								break
-							}
-							return
-						}
-
-						autobuild()
-					}()
+					schedule(e.Name)
+				}
+			case err, ok := <-errs:
+				if !ok {
+					errs = nil
+					continue
 				}
-			case err := <-watcher.Error:
 				faygo.Warningf("[fay] %s", err.Error()) // No need to exit here
 			}
 		}
 	}()
 
 	faygo.Printf("[fay] Initializing watcher...")
+	gitignored = newGitignore(curpath)
+	for _, name := range dirs.add(filepath.Clean(curpath)) {
+		checkFileChanged(name)
+	}
+	return func() {
+		watcher.Close()
+		<-done
+	}
+}
+
+// watchedDirs are the directories watched by the watcher.
+type watchedDirs struct {
+	*fsnotify.Watcher
+	lock sync.Mutex
+	dirs map[string]bool
+}
+
+// add watches the directory and its subdirectories which may hold watched files,
+// and returns the watched files in the newly watched directories.
+func (w *watchedDirs) add(dir string) (files []string) {
 	var paths []string
-	readAppDirectories(curpath, &paths)
+	readAppDirectories(dir, &paths)
+	w.lock.Lock()
+	defer w.lock.Unlock()
 	for _, path := range paths {
+		if w.dirs[path] {
+			continue
+		}
 		faygo.Printf("[fay] Directory( %s )", path)
-		err = watcher.Watch(path)
-		if err != nil {
-			faygo.Errorf("[fay] Fail to watch curpathectory[ %s ]", err)
-			os.Exit(2)
+		if err := w.Watch(path); err != nil {
+			faygo.Errorf("[fay] Fail to watch directory[ %s ]", err)
+			continue
+		}
+		w.dirs[path] = true
+		fileInfos, _ := ioutil.ReadDir(path)
+		for _, fileInfo := range fileInfos {
+			name := filepath.Join(path, fileInfo.Name())
+			if !fileInfo.IsDir() && checkIfWatched(name) {
+				files = append(files, name)
+			}
 		}
 	}
+	return files
 }
 
-// getFileModTime retuens unix timestamp of `os.File.ModTime` by given path.
-func getFileModTime(path string) int64 {
-	path = strings.Replace(path, "\\", "/", -1)
-	f, err := os.Open(path)
-	if err != nil {
-		faygo.Errorf("[fay] Fail to open file[ %s ]", err)
-		return time.Now().Unix()
+// remove stops watching the deleted or renamed directory and its subdirectories,
+// and returns false if it was not watched.
+func (w *watchedDirs) remove(dir string) bool {
+	dir = filepath.Clean(dir)
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	var removed bool
+	for path := range w.dirs {
+		if path != dir && !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			continue
+		}
+		// the watch of a deleted directory may be gone already
+		w.RemoveWatch(path)
+		delete(w.dirs, path)
+		faygo.Printf("[fay] Forget directory( %s )", path)
+		removed = true
 	}
-	defer f.Close()
+	return removed
+}
 
-	fi, err := f.Stat()
+// checkFileChanged records the content hash of the file, and returns true if
+// the content changed since the last call, so that two saves within a second
+// are both changes, and touching a file is not. A removed file is a change.
+func checkFileChanged(name string) bool {
+	hash, err := sha256File(name)
+	hashesLock.Lock()
+	defer hashesLock.Unlock()
 	if err != nil {
-		faygo.Errorf("[fay] Fail to get file information[ %s ]", err)
-		return time.Now().Unix()
+		delete(fileHashes, name)
+		return true
+	}
+	old, ok := fileHashes[name]
+	fileHashes[name] = hash
+	return !ok || old != hash
+}
+
+// watch actions, a greater one includes the smaller ones
+const (
+	actionReload  = iota + 1 // reload the browser pages
+	actionRestart            // restart the app without building it
+	actionRebuild            // build and restart the app
+)
+
+var watchActions = map[string]int{
+	"reload":  actionReload,
+	"restart": actionRestart,
+	"rebuild": actionRebuild,
+}
+
+// fileAction returns nothing for the files in the watch scope of a process,
+// which are not the app's, the action of the first rule matching the changed
+// file, or rebuild for the other files, e.g. the include globs, and the
+// removed directories.
+func fileAction(name string) int {
+	rel := relPath(name)
+	for _, pr := range procs {
+		if matchSelfOrParent(pr.watch, rel) {
+			return 0
+		}
+	}
+	for _, rule := range cfg.Watch.Rules {
+		if matchSelfOrParent([]string{rule.Glob}, rel) {
+			return rule.action
+		}
 	}
+	return actionRebuild
+}
 
-	return fi.ModTime().Unix()
+// onChange rebuilds the processes watching the changed files, and runs the
+// greatest action of the changed files for the app.
+func onChange(ctx context.Context, files []string) error {
+	for _, pr := range procs {
+		if !pr.watches(files) {
+			continue
+		}
+		if err := pr.rebuild(ctx); err != nil {
+			return err
+		}
+	}
+	var action int
+	for _, name := range files {
+		if a := fileAction(name); a > action {
+			action = a
+		}
+	}
+	switch action {
+	case actionRebuild:
+		return autobuild(ctx)
+	case actionRestart:
+		autorestart()
+	case actionReload:
+		faygo.Printf("[fay] Reload without restarting")
+		reloader.reload()
+	}
+	return nil
+}
+
+// autorestart restarts the app without building it.
+func autorestart() {
+	state.Lock()
+	defer state.Unlock()
+	mainApp.resetCrashes()
+	Restart()
 }
 
-func autobuild() {
+// autobuild builds and restarts the app, it returns the error of the context
+// if the build is canceled, and the app is not restarted then.
+func autobuild(ctx context.Context) error {
 	state.Lock()
 	defer state.Unlock()
+	mainApp.resetCrashes()
 	faygo.Printf("[fay] Start build...")
-	appName := appname
-	if runtime.GOOS == "windows" {
-		appName += ".exe"
+	if err := runHooks("pre_build", cfg.Hooks.PreBuild); err != nil {
+		faygo.Errorf("[fay] ============== Build failed ===================\n%v", err)
+		return nil
+	}
+	if ctx.Err() != nil {
+		faygo.Printf("[fay] Build canceled by new changes")
+		return ctx.Err()
 	}
-	n := strings.LastIndex(curpath, "/src/")
-	if n == -1 {
-		faygo.Fatalf("[fay] The project is not under src, can not run: %s", curpath)
+	project, err := detectGoProject(curpath)
+	if err != nil {
+		fatalf("[fay] Can not build: %v", err)
 	}
-	cmd := exec.Command("go", "build", "-o", appName)
-	cmd.Env = append([]string{"GOPATH=" + curpath[:n]}, os.Environ()...)
+	faygo.Printf("[fay] Build in %s", project)
+	args := cfg.buildArgs()
+	faygo.Printf("[fay] %s", strings.Join(args, " "))
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = project.dir
+	cmd.Env = cfg.environ(project.env(os.Environ()))
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	err := cmd.Run()
+	// the compiler and linker processes of go build are killed with it
+	err = runGroup(ctx, cmd)
+	if ctx.Err() != nil {
+		// the binary is stale even if the build finished, a new build follows
+		faygo.Printf("[fay] Build canceled by new changes")
+		return ctx.Err()
+	}
 	if err != nil {
 		faygo.Errorf("[fay] ============== Build failed ===================")
-		return
+		return nil
 	}
 	faygo.Printf("[fay] Build was successful")
-	Restart()
-}
-
-func Restart() {
-	var start string
-	if isFirstStart {
-		isFirstStart = false
-		faygo.Printf("[fay] Starting app: %s", appname)
-		start = "Start"
-	} else {
-		faygo.Printf("[fay] Restarting app: %s", appname)
-		defer func() {
-			if e := recover(); e != nil {
-				faygo.Printf("[fay] Kill.recover -> %v", e)
-			}
-		}()
-		if cmd != nil && cmd.Process != nil {
-			err := cmd.Process.Kill()
-			if err != nil {
-				faygo.Printf("[fay] Kill -> %v", err)
-			}
-		}
-		start = "Restart"
+	if err = runHooks("post_build", cfg.Hooks.PostBuild); err != nil {
+		faygo.Errorf("[fay] %v", err)
+		return nil
 	}
-	go func() {
-		cmd = exec.Command("./" + appname)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Env = os.Environ()
-		if err := cmd.Start(); err != nil {
-			faygo.Errorf("[fay] Fail to start app[ %s ]", err)
-			return
-		}
-		faygo.Printf("[fay] %s was successful", start)
-		cmd.Wait()
-		faygo.Printf("[fay] Old process was stopped")
-	}()
+	Restart()
+	return nil
 }
 
 // checkTMPFile returns true if the event was for TMP files.
@@ -188,40 +317,101 @@ func checkTMPFile(name string) bool {
 	return false
 }
 
-var watchExts = []string{".go"}
-
-// checkIfWatchExt returns true if the name HasSuffix <watch_ext>.
-func checkIfWatchExt(name string) bool {
-	for _, s := range watchExts {
+// checkIfWatched returns true if the name HasSuffix <watch_ext> or matches
+// a rule glob or a watch glob of a process, and it is not ignored by the
+// `.gitignore` files; or it matches an include glob. A file matching an
+// exclude glob, or in such a directory, is never watched.
+func checkIfWatched(name string) bool {
+	rel := relPath(name)
+	if matchSelfOrParent(cfg.Watch.Exclude, rel) {
+		return false
+	}
+	if matchSelfOrParent(cfg.Watch.Include, rel) {
+		return true
+	}
+	if gitignored.ignored(rel, false) {
+		return false
+	}
+	for _, s := range cfg.Watch.Exts {
 		if strings.HasSuffix(name, s) {
 			return true
 		}
 	}
+	for _, rule := range cfg.Watch.Rules {
+		if matchSelfOrParent([]string{rule.Glob}, rel) {
+			return true
+		}
+	}
+	for _, pr := range procs {
+		if matchSelfOrParent(pr.watch, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfWatchedDir returns true if the directory may hold watched files:
+// it is not hidden and does not match an exclude glob, and it is not ignored
+// by the `.gitignore` files, or an include glob may match in it.
+func checkIfWatchedDir(name string) bool {
+	rel := relPath(name)
+	if rel == "." {
+		return true
+	}
+	if strings.HasPrefix(path.Base(rel), ".") || matchSelfOrParent(cfg.Watch.Exclude, rel) {
+		return false
+	}
+	if !gitignored.ignored(rel, true) || matchSelfOrParent(cfg.Watch.Include, rel) {
+		return true
+	}
+	for _, glob := range cfg.Watch.Include {
+		if mayMatchUnder(glob, rel) {
+			return true
+		}
+	}
 	return false
 }
 
-func readAppDirectories(curpathectory string, paths *[]string) {
-	fileInfos, err := ioutil.ReadDir(curpathectory)
+// relPath returns the slash separated path relative to the project.
+func relPath(name string) string {
+	rel, err := filepath.Rel(curpath, name)
 	if err != nil {
-		return
+		return filepath.ToSlash(name)
 	}
+	return filepath.ToSlash(rel)
+}
 
-	useDirectory := false
-	for _, fileInfo := range fileInfos {
-		if fileInfo.IsDir() == true && fileInfo.Name()[0] != '.' {
-			readAppDirectories(filepath.Join(curpathectory, fileInfo.Name()), paths)
-			continue
+// matchGlobs returns true if the relative path matches one of the globs.
+// A `**` matches any number of directories, and a glob without `/`
+// is matched against the base name as well.
+func matchGlobs(globs []string, rel string) bool {
+	for _, glob := range globs {
+		glob = strings.TrimSuffix(glob, "/")
+		if matchSegments(strings.Split(glob, "/"), strings.Split(rel, "/")) {
+			return true
 		}
-
-		if useDirectory == true {
+		if strings.Contains(glob, "/") {
 			continue
 		}
-
-		if checkIfWatchExt(fileInfo.Name()) {
-			*paths = append(*paths, curpathectory)
-			useDirectory = true
+		if ok, _ := path.Match(glob, path.Base(rel)); ok {
+			return true
 		}
 	}
+	return false
+}
 
-	return
+// readAppDirectories collects the directory and its subdirectories which may
+// hold watched files, including the empty ones, where files may be created later.
+func readAppDirectories(directory string, paths *[]string) {
+	*paths = append(*paths, directory)
+	fileInfos, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return
+	}
+	for _, fileInfo := range fileInfos {
+		name := filepath.Join(directory, fileInfo.Name())
+		if fileInfo.IsDir() && checkIfWatchedDir(name) {
+			readAppDirectories(name, paths)
+		}
+	}
 }
@@ -0,0 +1,191 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// tempProject creates the files of a project in a temp dir, and makes it the
+// current project with the default config.
+func tempProject(t *testing.T, files map[string]string) (root string, restore func()) {
+	root, err := ioutil.TempDir("", "fay-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if content == "/" {
+			continue
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldPath, oldCfg, oldIgnored := curpath, cfg, gitignored
+	curpath = root + "/"
+	cfg = &fayConfig{}
+	if err := cfg.init("app"); err != nil {
+		t.Fatal(err)
+	}
+	gitignored = newGitignore(root)
+	return root, func() {
+		curpath, cfg, gitignored = oldPath, oldCfg, oldIgnored
+		os.RemoveAll(root)
+	}
+}
+
+func TestWatchNewDirectories(t *testing.T) {
+	// a value of "/" makes a dir without files
+	root, restore := tempProject(t, map[string]string{
+		"main.go":          "package main\n",
+		"internal/a/x":     "/",
+		"empty/x":          "/",
+		"node_modules/x/x": "/",
+		".gitignore":       "node_modules/\n",
+	})
+	defer restore()
+	cfg.Watch.delay = 50 * time.Millisecond
+	changes := make(chan string, 100)
+	stop := newWatcher(func(ctx context.Context, files []string) error {
+		for _, name := range files {
+			changes <- name
+		}
+		return nil
+	})
+	defer stop()
+
+	var cases = []struct {
+		name   string
+		create func(name string) error
+	}{
+		{"internal/b/b.go", func(name string) error {
+			if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+				return err
+			}
+			return ioutil.WriteFile(name, []byte("package b\n"), 0666)
+		}},
+		{"empty/first.go", func(name string) error {
+			return ioutil.WriteFile(name, []byte("package empty\n"), 0666)
+		}},
+		{"internal/a/c/d/d.go", func(name string) error {
+			if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+				return err
+			}
+			return ioutil.WriteFile(name, []byte("package d\n"), 0666)
+		}},
+	}
+	for _, c := range cases {
+		name := filepath.Join(root, filepath.FromSlash(c.name))
+		if err := c.create(name); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case got := <-changes:
+			if got != name {
+				t.Errorf("%s: got change of %s", c.name, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("%s: no change", c.name)
+		}
+	}
+	// the ignored dirs are not watched
+	name := filepath.Join(root, "node_modules", "x", "x.go")
+	if err := ioutil.WriteFile(name, []byte("package x\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-changes:
+		t.Errorf("node_modules/x/x.go: got change of %s", got)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestFileAction(t *testing.T) {
+	root, restore := tempProject(t, nil)
+	defer restore()
+	defer func(old []*proc) { procs = old }(procs)
+	procs = []*proc{{name: "worker", watch: []string{"cmd/worker/**", "internal/queue"}}}
+	// the first rule wins, after the defaults rebuild, restart and reload
+	cfg.Watch.Rules = append([]watchRule{
+		{Glob: "static/tpl/*.html", Action: "restart"},
+	}, defaultWatchRules()...)
+	if err := cfg.init("app"); err != nil {
+		t.Fatal(err)
+	}
+	var cases = []struct {
+		rel  string
+		want int
+	}{
+		{"main.go", actionRebuild},
+		{"internal/model/user.go", actionRebuild},
+		{"config/app.ini", actionRestart},
+		{"view/index.html", actionRestart},
+		{"static/js/app.js", actionReload},
+		{"static/tpl/index.html", actionRestart},
+		// a go file in static matches `*.go` first
+		{"static/gen.go", actionRebuild},
+		// without a rule, e.g. the include globs
+		{"Makefile", actionRebuild},
+		// the files of the processes are not the app's
+		{"cmd/worker/main.go", 0},
+		{"internal/queue/queue.go", 0},
+	}
+	for _, c := range cases {
+		if got := fileAction(filepath.Join(root, filepath.FromSlash(c.rel))); got != c.want {
+			t.Errorf("fileAction(%q) = %d, want %d", c.rel, got, c.want)
+		}
+	}
+}
+
+func TestCheckFileChanged(t *testing.T) {
+	root, restore := tempProject(t, map[string]string{"a.go": "package a\n"})
+	defer restore()
+	name := filepath.Join(root, "a.go")
+	var cases = []struct {
+		name   string
+		action func() error
+		want   bool
+	}{
+		{"first check", func() error { return nil }, true},
+		{"no change", func() error { return nil }, false},
+		{"touch", func() error {
+			now := time.Now().Add(time.Minute)
+			return os.Chtimes(name, now, now)
+		}, false},
+		{"same content", func() error { return ioutil.WriteFile(name, []byte("package a\n"), 0666) }, false},
+		// two saves within a second are both changes
+		{"edit", func() error { return ioutil.WriteFile(name, []byte("package b\n"), 0666) }, true},
+		{"edit again", func() error { return ioutil.WriteFile(name, []byte("package c\n"), 0666) }, true},
+		{"delete", func() error { return os.Remove(name) }, true},
+		{"create again", func() error { return ioutil.WriteFile(name, []byte("package c\n"), 0666) }, true},
+	}
+	for _, c := range cases {
+		if err := c.action(); err != nil {
+			t.Fatal(err)
+		}
+		if got := checkFileChanged(name); got != c.want {
+			t.Errorf("%s: got changed %v, want %v", c.name, got, c.want)
+		}
+	}
+}